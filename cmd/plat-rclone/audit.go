@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"sort"
+
+	"github.com/joeblew999/plat-rclone/pkg/audit"
+	"github.com/joeblew999/plat-rclone/pkg/datastar"
+	"github.com/joeblew999/plat-rclone/pkg/rclone"
+	"github.com/joeblew999/plat-rclone/pkg/router"
+	"github.com/joeblew999/plat-rclone/templates"
+)
+
+// auditLimit caps how many entries the audit view renders.
+const auditLimit = 200
+
+// recordAudit appends e for the current request to auditLog, with err as
+// its result. A nil auditLog records nothing.
+func recordAudit(ctx *router.Context, auditLog *audit.Log, e audit.Entry, err error) {
+	if auditLog == nil {
+		return
+	}
+	req := ctx.Request
+	e.IP = req.RemoteAddr
+	if host, _, splitErr := net.SplitHostPort(req.RemoteAddr); splitErr == nil {
+		e.IP = host
+	}
+	if fwd := req.Header.Get("X-Forwarded-For"); fwd != "" {
+		e.IP += " (for " + fwd + ")"
+	}
+	e.User = requestUser(req)
+	if err != nil {
+		e.Error = err.Error()
+	}
+	if err := auditLog.Append(e); err != nil {
+		log.Printf("audit: %v", err)
+	}
+}
+
+// transferParams describes a transfer for an audit entry.
+func transferParams(t rclone.Transfer) map[string]any {
+	params := map[string]any{
+		"op":  t.Op,
+		"src": t.SrcFs(),
+		"dst": t.DstFs(),
+	}
+	if t.Group != "" {
+		params["group"] = t.Group
+	}
+	if len(t.Filter) > 0 {
+		params["filter"] = t.Filter
+	}
+	if len(t.Config) > 0 {
+		params["config"] = t.Config
+	}
+	if t.DeleteEmptySrcDirs {
+		params["deleteEmptySrcDirs"] = true
+	}
+	return params
+}
+
+func registerAuditRoutes(r *router.Router, auditLog *audit.Log) {
+	r.Page("/audit", func(ctx *router.Context) (string, error) {
+		entries, err := getAuditInfo(auditLog, "")
+		if err != nil {
+			return "", err
+		}
+		return datastar.RenderTempl(templates.AuditPage(entries))
+	})
+
+	// API: Search the audit log
+	r.GET("/api/audit", func(ctx *router.Context) error {
+		var signals struct {
+			AuditQuery string `json:"auditQuery"`
+		}
+		ctx.ReadSignals(&signals)
+		sse := ctx.SSE()
+
+		entries, err := getAuditInfo(auditLog, signals.AuditQuery)
+		if err != nil {
+			return sse.PatchHTMLByID("audit-list", `<div id="audit-list" class="error">`+err.Error()+`</div>`)
+		}
+		return sse.PatchTempl(templates.AuditList(entries))
+	})
+}
+
+func getAuditInfo(auditLog *audit.Log, query string) ([]templates.AuditEntry, error) {
+	if auditLog == nil {
+		return nil, nil
+	}
+	list, err := auditLog.Search(query, auditLimit)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]templates.AuditEntry, len(list))
+	for i, e := range list {
+		var params []templates.HistoryDetail
+		for _, key := range sortedKeys(e.Params) {
+			params = append(params, templates.HistoryDetail{Label: key, Value: fmtParam(e.Params[key])})
+		}
+		entries[i] = templates.AuditEntry{
+			Time:   e.Time.Local().Format("2006-01-02 15:04:05"),
+			User:   e.User,
+			IP:     e.IP,
+			Action: e.Action,
+			Remote: e.Remote,
+			Path:   e.Path,
+			Params: params,
+			Result: e.Result,
+			Error:  e.Error,
+		}
+	}
+	return entries, nil
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// fmtParam renders an audit parameter: strings as-is, anything else as JSON.
+func fmtParam(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
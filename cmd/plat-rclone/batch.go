@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/joeblew999/plat-rclone/pkg/audit"
+	"github.com/joeblew999/plat-rclone/pkg/datastar"
+	"github.com/joeblew999/plat-rclone/pkg/prefs"
+	"github.com/joeblew999/plat-rclone/pkg/queue"
+	"github.com/joeblew999/plat-rclone/pkg/rclone"
+	"github.com/joeblew999/plat-rclone/pkg/router"
+	"github.com/joeblew999/plat-rclone/pkg/rpath"
+	"github.com/joeblew999/plat-rclone/pkg/trash"
+	"github.com/joeblew999/plat-rclone/templates"
+)
+
+// batchParallel is how many items of a batch delete or hash run at once.
+const batchParallel = 4
+
+// selectionSignals are the items ticked in the file browser, by name in
+// the folder shown, and where to copy or move them.
+type selectionSignals struct {
+	Selection struct {
+		Names []string `json:"names"`
+		Dst   string   `json:"dst"` // remote:path
+	} `json:"selection"`
+}
+
+// names returns the selected names, checked and without repeats.
+func (s selectionSignals) names() ([]string, error) {
+	var names []string
+	seen := map[string]bool{}
+	for _, name := range s.Selection.Names {
+		if err := validName(name); err != nil {
+			return nil, err
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("select something first")
+	}
+	return names, nil
+}
+
+func registerBatchRoutes(r *router.Router, rc *rclone.Client, q *queue.Queue, trashBin *trash.Trash, auditLog *audit.Log, userPrefs *prefs.Store, listings *listingRuns, batches *runStops) {
+	// API: Delete the selected items, into the trash where there is one,
+	// reporting each as it goes
+	r.POST("/api/batch/{remote}/delete", func(ctx *router.Context) error {
+		var signals selectionSignals
+		ctx.ReadSignals(&signals)
+		sse := ctx.SSE()
+		remote := ctx.Param("remote")
+		dir := rpath.Clean(ctx.Query("path"))
+		names, err := signals.names()
+		if err != nil {
+			return sse.PatchTempl(templates.Toast(err.Error(), true))
+		}
+
+		refresh := func() error { return patchFileBrowser(ctx, sse, listings, userPrefs, remote, dir) }
+		return runBatch(ctx, sse, batches, "Delete", "deleted", names, refresh, func(name string) templates.BatchResult {
+			r := templates.BatchResult{Name: name}
+			item, err := deleteItem(ctx, auditLog, trashBin, remote, rpath.Join(dir, name))
+			switch {
+			case err != nil:
+				r.Detail = err.Error()
+			case item != nil:
+				r.OK, r.Detail = true, "moved to the trash"
+			default:
+				r.OK, r.Detail = true, "deleted"
+			}
+			return r
+		})
+	})
+
+	// API: Copy or move the selected items to another folder as one job,
+	// which rclone runs with the items as its include rules
+	for _, op := range []string{"copy", "move"} {
+		r.POST("/api/batch/{remote}/"+op, func(ctx *router.Context) error {
+			var signals selectionSignals
+			ctx.ReadSignals(&signals)
+			sse := ctx.SSE()
+			remote := ctx.Param("remote")
+			dir := rpath.Clean(ctx.Query("path"))
+			names, err := signals.names()
+			if err != nil {
+				return sse.PatchTempl(templates.Toast(err.Error(), true))
+			}
+			dstRemote, dstPath, err := rclone.SplitFs(strings.TrimSpace(signals.Selection.Dst))
+			if err != nil {
+				return sse.PatchTempl(templates.Toast("Destination: "+err.Error(), true))
+			}
+			dstPath = rpath.Clean(dstPath)
+			if dstRemote == remote {
+				if dstPath == dir {
+					return sse.PatchTempl(templates.Toast("Pick a folder other than this one", true))
+				}
+				for _, name := range names {
+					if src := rpath.Join(dir, name); dstPath == src || strings.HasPrefix(dstPath, src+"/") {
+						return sse.PatchTempl(templates.Toast("Cannot "+op+" "+name+" into itself", true))
+					}
+				}
+			}
+
+			t := rclone.Transfer{
+				Op:                 op,
+				SrcRemote:          remote,
+				SrcPath:            dir,
+				DstRemote:          dstRemote,
+				DstPath:            dstPath,
+				Group:              op + ":" + remote,
+				Filter:             map[string]any{"IncludeRule": rclone.NameRules(names)},
+				DeleteEmptySrcDirs: op == "move", // moved folders go with their files
+			}
+			it := q.Submit(t, queue.Normal, "browser")
+			params := transferParams(t)
+			params["names"] = names
+			if it.Status == "error" {
+				err = fmt.Errorf("%s", it.Error)
+			}
+			recordAudit(ctx, auditLog, audit.Entry{Action: "transfer.submit", Remote: remote, Path: dir, Params: params}, err)
+
+			detail := fmt.Sprintf("in job #%d", it.JobID)
+			if it.Status == "queued" {
+				detail = fmt.Sprintf("in queue item #%d, waiting for a free slot", it.ID)
+			}
+			results := make([]templates.BatchResult, len(names))
+			state := templates.BatchState{Total: len(names), Done: len(names)}
+			for i, name := range names {
+				results[i] = templates.BatchResult{Name: name, OK: err == nil, Detail: detail}
+				if err != nil {
+					results[i].Detail = err.Error()
+					state.Failed++
+				}
+			}
+			sse.PatchSignals(map[string]any{"selection": map[string]any{"names": []string{}}})
+			verb := map[string]string{"copy": "Copy", "move": "Move"}[op]
+			return patchBatchResults(sse, verb+" to "+t.DstFs(), "submitted", state, results)
+		})
+	}
+
+	// API: Show the hashes of the selected files as they come
+	r.POST("/api/batch/{remote}/hash", func(ctx *router.Context) error {
+		var signals selectionSignals
+		ctx.ReadSignals(&signals)
+		sse := ctx.SSE()
+		remote := ctx.Param("remote")
+		dir := rpath.Clean(ctx.Query("path"))
+		names, err := signals.names()
+		if err != nil {
+			return sse.PatchTempl(templates.Toast(err.Error(), true))
+		}
+
+		return runBatch(ctx, sse, batches, "Hash", "hashed", names, nil, func(name string) templates.BatchResult {
+			r := templates.BatchResult{Name: name}
+			hashes, err := rc.Hashes(remote, rpath.Join(dir, name))
+			switch hash := preferredHash(hashes); {
+			case err != nil:
+				r.Detail = err.Error()
+			case hash == "":
+				r.Detail = "no hash; folders and some remotes have none"
+			default:
+				r.OK, r.Detail = true, hash
+			}
+			return r
+		})
+	})
+
+	// API: Stop a running batch; items already started still finish
+	r.POST("/api/batches/{id}/stop", func(ctx *router.Context) error {
+		ctx.SSE()
+		batches.cancel(ctx.Param("id"))
+		return nil
+	})
+}
+
+// runBatch does each named item, a few at a time, adding how it went to
+// the results as it ends. It stops taking items when the batch is stopped
+// or the page is left. refresh, if set, patches the file browser, which
+// holds the results, once the batch ends.
+func runBatch(ctx *router.Context, sse *datastar.SSE, batches *runStops, title, done string, names []string, refresh func() error, do func(name string) templates.BatchResult) error {
+	runCtx, cancel := context.WithCancel(ctx.Request.Context())
+	defer cancel()
+	id, remove := batches.add(cancel)
+	defer remove()
+
+	state := templates.BatchState{ID: id, Total: len(names), Running: true}
+	sse.PatchTempl(templates.BatchResults(title, state, nil))
+
+	next := make(chan string)
+	results := make(chan templates.BatchResult)
+	var wg sync.WaitGroup
+	for range min(batchParallel, len(names)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range next {
+				results <- do(name)
+			}
+		}()
+	}
+	go func() {
+		defer close(next)
+		for _, name := range names {
+			select {
+			case next <- name:
+			case <-runCtx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var all []templates.BatchResult
+	for r := range results {
+		all = append(all, r)
+		state.Done++
+		if !r.OK {
+			state.Failed++
+		}
+		sse.AppendTemplByID("batch-rows", templates.BatchRow(r))
+		sse.PatchTempl(templates.BatchStatus(state))
+	}
+	state.Running, state.Stopped = false, state.Done < state.Total
+	if refresh != nil {
+		if err := refresh(); err != nil {
+			return err
+		}
+	}
+	return patchBatchResults(sse, title, done, state, all)
+}
+
+// patchBatchResults shows how a batch action went for each item, with a
+// toast summing it up.
+func patchBatchResults(sse *datastar.SSE, title, done string, s templates.BatchState, results []templates.BatchResult) error {
+	sse.PatchTempl(templates.BatchResults(title, s, results))
+	switch {
+	case s.Failed > 0:
+		return sse.PatchTempl(templates.Toast(fmt.Sprintf("%s: %d of %d failed", title, s.Failed, s.Total), true))
+	case s.Stopped:
+		return sse.PatchTempl(templates.Toast(fmt.Sprintf("%s: stopped after %d of %d", title, s.Done, s.Total), false))
+	}
+	return sse.PatchTempl(templates.Toast(fmt.Sprintf("%s: %d %s", title, s.Total, done), false))
+}
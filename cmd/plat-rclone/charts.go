@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/joeblew999/plat-rclone/pkg/router"
+	"github.com/joeblew999/plat-rclone/pkg/stats"
+	"github.com/joeblew999/plat-rclone/templates"
+)
+
+// chartWindows are the selectable spans of the throughput charts.
+var chartWindows = map[string]time.Duration{
+	"5m":  5 * time.Minute,
+	"1h":  time.Hour,
+	"24h": 24 * time.Hour,
+}
+
+// chartPoints caps how many points a chart draws, whatever the window.
+const chartPoints = 120
+
+func registerChartRoutes(r *router.Router, sampler *stats.Sampler) {
+	// API: Re-render the throughput charts for the selected window
+	r.GET("/api/stats/charts", func(ctx *router.Context) error {
+		var signals struct {
+			StatsWindow string `json:"statsWindow"`
+		}
+		ctx.ReadSignals(&signals)
+		sse := ctx.SSE()
+		return sse.PatchTempl(templates.StatsCharts(getChartsInfo(sampler, signals.StatsWindow)))
+	})
+}
+
+func getChartsInfo(sampler *stats.Sampler, window string) templates.ChartsInfo {
+	d, ok := chartWindows[window]
+	if !ok {
+		window, d = "5m", chartWindows["5m"]
+	}
+	samples := sampler.Window(d, chartPoints)
+
+	speed := templates.ChartInfo{Title: "Speed", Latest: "0 B/s", Peak: "0 B/s"}
+	bytes := templates.ChartInfo{Title: "Transferred"}
+	transfers := templates.ChartInfo{Title: "Transfers"}
+	errors := templates.ChartInfo{Title: "Errors"}
+	var peak float64
+	for _, s := range samples {
+		speed.Values = append(speed.Values, s.Speed)
+		bytes.Values = append(bytes.Values, float64(s.Bytes))
+		transfers.Values = append(transfers.Values, float64(s.Transfers))
+		errors.Values = append(errors.Values, float64(s.Errors))
+		peak = max(peak, s.Speed)
+	}
+	if n := len(samples); n > 0 {
+		last := samples[n-1]
+		speed.Latest = formatSize(int64(last.Speed)) + "/s"
+		speed.Peak = formatSize(int64(peak)) + "/s"
+		bytes.Latest = formatSize(last.Bytes)
+		transfers.Latest = fmt.Sprint(last.Transfers)
+		errors.Latest = fmt.Sprint(last.Errors)
+	}
+
+	info := templates.ChartsInfo{
+		Window: window,
+		Speed:  speed,
+		Totals: []templates.ChartInfo{bytes, transfers, errors},
+	}
+	if stalled := sampler.Stalled(); stalled >= 3*sampler.Interval() {
+		info.Stalled = stalled.Round(time.Second).String()
+	}
+	return info
+}
@@ -0,0 +1,452 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joeblew999/plat-rclone/pkg/audit"
+	"github.com/joeblew999/plat-rclone/pkg/datastar"
+	"github.com/joeblew999/plat-rclone/pkg/dupes"
+	"github.com/joeblew999/plat-rclone/pkg/rclone"
+	"github.com/joeblew999/plat-rclone/pkg/router"
+	"github.com/joeblew999/plat-rclone/pkg/rpath"
+	"github.com/joeblew999/plat-rclone/pkg/trash"
+	"github.com/joeblew999/plat-rclone/templates"
+)
+
+const (
+	// dupesShown is how many groups, most wasteful first, are shown.
+	dupesShown = 500
+	// dupesHashers is how many files are hashed at once.
+	dupesHashers = 8
+	// dupesIdle is how long a finished scan is kept for deleting from.
+	dupesIdle = 30 * time.Minute
+)
+
+// dupesSignals is the duplicates form and the copies ticked for deleting,
+// keyed by dupeKey.
+type dupesSignals struct {
+	Dupes struct {
+		Paths    string          `json:"paths"` // remote:path, one per line
+		Selected map[string]bool `json:"selected"`
+	} `json:"dupes"`
+}
+
+// dupeScan is a search for duplicates, kept once finished so copies can
+// be deleted from its groups.
+type dupeScan struct {
+	id     string
+	cancel context.CancelFunc
+
+	used time.Time // guarded by dupeScans.mu
+
+	mu     sync.Mutex
+	groups []dupes.Group // most wasteful first; nil while running
+}
+
+// dupeScans holds the running and recently finished scans by ID.
+type dupeScans struct {
+	mu    sync.Mutex
+	scans map[string]*dupeScan
+}
+
+func newDupeScans() *dupeScans {
+	return &dupeScans{scans: map[string]*dupeScan{}}
+}
+
+// get returns the scan with id, or nil once it has expired.
+func (d *dupeScans) get(id string) *dupeScan {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	scan := d.scans[id]
+	if scan != nil {
+		scan.used = time.Now()
+	}
+	return scan
+}
+
+// add files a new scan, dropping those idle for dupesIdle.
+func (d *dupeScans) add(scan *dupeScan) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id, old := range d.scans {
+		if time.Since(old.used) > dupesIdle {
+			delete(d.scans, id)
+		}
+	}
+	d.scans[scan.id] = scan
+}
+
+func registerDupesRoutes(r *router.Router, rc *rclone.Client, trashBin *trash.Trash, auditLog *audit.Log, scans *dupeScans) {
+	// The duplicates page; path starts it on one folder
+	r.Page("/duplicates", func(ctx *router.Context) (string, error) {
+		return datastar.RenderTempl(templates.DupesPage(ctx.Query("path")))
+	})
+
+	// API: List the paths, hash the files that share a size, and show the
+	// groups of identical files
+	r.GET("/api/duplicates", func(ctx *router.Context) error {
+		var signals dupesSignals
+		ctx.ReadSignals(&signals)
+		sse := ctx.SSE()
+
+		var locations [][2]string
+		for _, line := range strings.Split(signals.Dupes.Paths, "\n") {
+			if line = strings.TrimSpace(line); line == "" {
+				continue
+			}
+			remote, path, err := rclone.SplitFs(line)
+			if err != nil {
+				return sse.PatchTempl(templates.DupesStatus(templates.DupesState{Errors: []string{err.Error()}}))
+			}
+			locations = append(locations, [2]string{remote, rpath.Clean(path)})
+		}
+		if len(locations) == 0 {
+			return sse.PatchTempl(templates.DupesStatus(templates.DupesState{Errors: []string{"enter at least one remote:path to look in"}}))
+		}
+		return findDupes(ctx, sse, rc, trashBin, scans, locations)
+	})
+
+	// API: Stop a running scan, showing what it has found
+	r.POST("/api/duplicates/{id}/stop", func(ctx *router.Context) error {
+		ctx.SSE()
+		if scan := scans.get(ctx.Param("id")); scan != nil {
+			scan.cancel()
+		}
+		return nil
+	})
+
+	// API: Tick every copy but one in each group. keep picks the copy
+	// left unticked: first, newest or oldest.
+	r.POST("/api/duplicates/{id}/select", func(ctx *router.Context) error {
+		sse := ctx.SSE()
+		scan := scans.get(ctx.Param("id"))
+		if scan == nil {
+			return sse.PatchTempl(templates.Toast("These results have expired; find duplicates again", true))
+		}
+		keep := ctx.Query("keep")
+		selected := map[string]bool{}
+		scan.mu.Lock()
+		for _, g := range scan.groups[:min(len(scan.groups), dupesShown)] {
+			kept := keptCopy(g, keep)
+			for i, f := range g.Files {
+				selected[dupeKey(f)] = keep != "" && i != kept
+			}
+		}
+		scan.mu.Unlock()
+		return sse.PatchSignals(map[string]any{"dupes": map[string]any{"selected": selected}})
+	})
+
+	// API: Delete the ticked copies through the trash, as the file browser
+	// does, refusing to delete every copy of anything
+	r.POST("/api/duplicates/{id}/delete", func(ctx *router.Context) error {
+		var signals dupesSignals
+		ctx.ReadSignals(&signals)
+		sse := ctx.SSE()
+		scan := scans.get(ctx.Param("id"))
+		if scan == nil {
+			return sse.PatchTempl(templates.Toast("These results have expired; find duplicates again", true))
+		}
+		scan.mu.Lock()
+		defer scan.mu.Unlock()
+
+		var doomed []dupes.File
+		for _, g := range scan.groups {
+			n := 0
+			for _, f := range g.Files {
+				if signals.Dupes.Selected[dupeKey(f)] {
+					n++
+				}
+			}
+			if n == len(g.Files) {
+				return sse.PatchTempl(templates.Toast("Keep at least one copy of "+g.Files[0].Name, true))
+			}
+			for _, f := range g.Files {
+				if signals.Dupes.Selected[dupeKey(f)] {
+					doomed = append(doomed, f)
+				}
+			}
+		}
+		if len(doomed) == 0 {
+			return sse.PatchTempl(templates.Toast("Tick the copies to delete first", true))
+		}
+
+		var trashed, deleted int
+		var freed int64
+		var failures []string
+		gone := map[string]bool{}
+		for _, f := range doomed {
+			item, err := deleteItem(ctx, auditLog, trashBin, f.Remote, f.Path)
+			if err != nil {
+				failures = append(failures, f.Remote+":"+f.Path+": "+err.Error())
+				continue
+			}
+			gone[dupeKey(f)] = true
+			if item != nil {
+				trashed++
+			} else {
+				deleted++
+				freed += f.Size
+			}
+		}
+		scan.groups = removeDupes(scan.groups, gone)
+
+		unselect := map[string]any{}
+		for key := range gone {
+			unselect[key] = nil
+		}
+		sse.PatchSignals(map[string]any{"dupes": map[string]any{"selected": unselect}})
+		sse.PatchTempl(templates.DupesGroups(scan.id, dupesView(scan.groups)))
+		sse.PatchTempl(templates.DupesStatus(dupesState(scan.id, scan.groups)))
+
+		var parts []string
+		if trashed > 0 {
+			parts = append(parts, fmt.Sprintf("Moved %d copies to the trash", trashed))
+		}
+		if deleted > 0 {
+			parts = append(parts, fmt.Sprintf("Deleted %d copies, freeing %s", deleted, formatSize(freed)))
+		}
+		if len(failures) > 0 {
+			parts = append(parts, fmt.Sprintf("%d failed: %s", len(failures), strings.Join(failures, "; ")))
+		}
+		return sse.PatchTempl(templates.Toast(strings.Join(parts, ". "), len(failures) > 0))
+	})
+}
+
+// findDupes lists every location but the trash, then hashes the files that
+// share a size with another, streaming progress, and shows the groups found.
+func findDupes(ctx *router.Context, sse *datastar.SSE, rc *rclone.Client, trashBin *trash.Trash, scans *dupeScans, locations [][2]string) error {
+	b := make([]byte, 8)
+	rand.Read(b)
+	scanCtx, cancel := context.WithCancel(ctx.Request.Context())
+	defer cancel()
+	scan := &dupeScan{id: hex.EncodeToString(b), cancel: cancel, used: time.Now()}
+	scans.add(scan)
+
+	state := templates.DupesState{ID: scan.id, Running: true, Phase: "Listing"}
+	sse.PatchTempl(templates.DupesGroups(scan.id, nil))
+	sse.PatchTempl(templates.DupesStatus(state))
+
+	// List every location, a few at a time. A file in two overlapping
+	// locations is only counted once.
+	var mu sync.Mutex
+	seen := map[string]bool{}
+	var files []dupes.File
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, searchParallel)
+	for _, loc := range locations {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			remote, dir := loc[0], loc[1]
+			opt := map[string]any{"recurse": true, "filesOnly": true}
+			filter := excludeTrash(trashBin, remote, dir, nil)
+			err := rc.ListStream(scanCtx, remote, dir, opt, filter, func(item rclone.ListItem) error {
+				if err := scanCtx.Err(); err != nil {
+					return err
+				}
+				path := rpath.Join(dir, item.Path)
+				mu.Lock()
+				defer mu.Unlock()
+				if !seen[remote+":"+path] {
+					seen[remote+":"+path] = true
+					files = append(files, dupes.File{
+						Remote:  remote,
+						Path:    path,
+						Name:    item.Name,
+						Size:    item.Size,
+						ModTime: item.ModTime,
+					})
+				}
+				return nil
+			})
+			if err != nil && scanCtx.Err() == nil {
+				mu.Lock()
+				state.Errors = append(state.Errors, remote+":"+dir+": "+err.Error())
+				mu.Unlock()
+			}
+		}()
+	}
+	listed := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(listed)
+	}()
+	listedAll := dupesProgress(scanCtx, sse, &mu, &state, listed, func() { state.Listed = len(files) })
+
+	// Only files sharing a size can be the same; hash those
+	var sets [][]dupes.File
+	if listedAll {
+		sets = dupes.BySize(files)
+	}
+	files = nil
+	var candidates []*dupes.File
+	for _, set := range sets {
+		for i := range set {
+			candidates = append(candidates, &set[i])
+		}
+	}
+	state.Phase, state.Candidates = "Hashing", len(candidates)
+	unhashed := map[string]bool{} // could not be hashed, so are left out
+	hashed := make(chan struct{})
+	go func() {
+		defer close(hashed)
+		next := make(chan *dupes.File)
+		var wg sync.WaitGroup
+		for range dupesHashers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for f := range next {
+					hashes, err := rc.Hashes(f.Remote, f.Path)
+					mu.Lock()
+					f.Hashes = hashes
+					state.Hashed++
+					if err != nil {
+						unhashed[f.Remote+":"+f.Path] = true
+						if len(state.Errors) < 20 {
+							state.Errors = append(state.Errors, f.Remote+":"+f.Path+": "+err.Error())
+						}
+					}
+					mu.Unlock()
+				}
+			}()
+		}
+		for _, f := range candidates {
+			select {
+			case next <- f:
+			case <-scanCtx.Done():
+			}
+			if scanCtx.Err() != nil {
+				break
+			}
+		}
+		close(next)
+		wg.Wait()
+	}()
+	stopped := !dupesProgress(scanCtx, sse, &mu, &state, hashed, func() {}) || !listedAll
+
+	var groups []dupes.Group
+	if !stopped {
+		for _, set := range sets {
+			set = slices.DeleteFunc(set, func(f dupes.File) bool {
+				return unhashed[f.Remote+":"+f.Path]
+			})
+			groups = append(groups, dupes.Match(set)...)
+		}
+		dupes.Sort(groups)
+	}
+	scan.mu.Lock()
+	scan.groups = groups
+	scan.mu.Unlock()
+	scans.get(scan.id) // keep it from the time it finished
+
+	final := dupesState(scan.id, groups)
+	final.Listed, final.Errors, final.Stopped = state.Listed, state.Errors, stopped
+	sse.PatchTempl(templates.DupesGroups(scan.id, dupesView(groups)))
+	return sse.PatchTempl(templates.DupesStatus(final))
+}
+
+// dupesProgress patches the scan's status until done is closed, calling
+// update under mu first each time. It returns false if ctx ended first,
+// by the scan being stopped or the page left.
+func dupesProgress(ctx context.Context, sse *datastar.SSE, mu *sync.Mutex, state *templates.DupesState, done chan struct{}, update func()) bool {
+	tick := time.NewTicker(listingTick)
+	defer tick.Stop()
+	for {
+		select {
+		case <-done:
+			mu.Lock()
+			update()
+			mu.Unlock()
+			return ctx.Err() == nil
+		case <-tick.C:
+			mu.Lock()
+			update()
+			s := *state
+			s.Errors = slices.Clone(state.Errors)
+			mu.Unlock()
+			sse.PatchTempl(templates.DupesStatus(s))
+		}
+	}
+}
+
+// keptCopy is the index of the copy in g to keep: the newest, the oldest
+// or else the first.
+func keptCopy(g dupes.Group, keep string) int {
+	kept := 0
+	for i, f := range g.Files {
+		switch {
+		case keep == "newest" && f.ModTime > g.Files[kept].ModTime,
+			keep == "oldest" && f.ModTime < g.Files[kept].ModTime:
+			kept = i
+		}
+	}
+	return kept
+}
+
+// dupeKey names a file's selection signal. It depends only on where the
+// file is, so ticks stay on the right copies as groups change.
+func dupeKey(f dupes.File) string {
+	h := fnv.New64a()
+	h.Write([]byte(f.Remote + ":" + f.Path))
+	return fmt.Sprintf("f%x", h.Sum64())
+}
+
+// removeDupes drops the files in gone from groups, and any group left
+// with a single copy.
+func removeDupes(groups []dupes.Group, gone map[string]bool) []dupes.Group {
+	kept := groups[:0]
+	for _, g := range groups {
+		g.Files = slices.DeleteFunc(g.Files, func(f dupes.File) bool {
+			return gone[dupeKey(f)]
+		})
+		if len(g.Files) > 1 {
+			kept = append(kept, g)
+		}
+	}
+	return kept
+}
+
+// dupesState totals the space groups waste.
+func dupesState(id string, groups []dupes.Group) templates.DupesState {
+	s := templates.DupesState{ID: id, Groups: len(groups), Shown: min(len(groups), dupesShown)}
+	var wasted int64
+	for _, g := range groups {
+		wasted += g.Wasted()
+	}
+	s.Wasted = formatSize(wasted)
+	return s
+}
+
+// dupesView lays out the most wasteful groups.
+func dupesView(groups []dupes.Group) []templates.DupeGroup {
+	var view []templates.DupeGroup
+	for _, g := range groups[:min(len(groups), dupesShown)] {
+		v := templates.DupeGroup{
+			Size:   formatSize(g.Size),
+			Wasted: formatSize(g.Wasted()),
+			By:     g.By,
+			Hash:   g.Hash,
+		}
+		for _, f := range g.Files {
+			v.Files = append(v.Files, templates.DupeFile{
+				Key:     dupeKey(f),
+				Remote:  f.Remote,
+				Path:    f.Path,
+				ModTime: f.ModTime,
+			})
+		}
+		view = append(view, v)
+	}
+	return view
+}
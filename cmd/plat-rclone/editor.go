@@ -0,0 +1,157 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/joeblew999/plat-rclone/pkg/audit"
+	"github.com/joeblew999/plat-rclone/pkg/prefs"
+	"github.com/joeblew999/plat-rclone/pkg/preview"
+	"github.com/joeblew999/plat-rclone/pkg/rclone"
+	"github.com/joeblew999/plat-rclone/pkg/router"
+	"github.com/joeblew999/plat-rclone/pkg/rpath"
+	"github.com/joeblew999/plat-rclone/templates"
+)
+
+// editLimit is the largest file the inline editor opens. Its content
+// travels as a signal, so it is kept small.
+const editLimit = 512 << 10
+
+// editorSignals is the open file as the editor loaded it. ModTime and Hash
+// are the version it was loaded at, compared against the remote on save.
+// The leading underscore keeps the content out of every other request.
+type editorSignals struct {
+	Editor struct {
+		Content string `json:"content"`
+		ModTime string `json:"modTime"`
+		Hash    string `json:"hash"`
+		Force   bool   `json:"force"`
+	} `json:"_editor"`
+}
+
+// editable reports whether the editor offers to open a file.
+func editable(item rclone.ListItem) bool {
+	return !item.IsDir && item.Size <= editLimit && !preview.Detect(item.Name).IsMedia()
+}
+
+func registerEditorRoutes(r *router.Router, rc *rclone.Client, auditLog *audit.Log, userPrefs *prefs.Store, listings *listingRuns) {
+	// API: Open a text file in the editor panel
+	r.GET("/api/edit/{remote}", func(ctx *router.Context) error {
+		sse := ctx.SSE()
+		remote := ctx.Param("remote")
+		file := rpath.Clean(ctx.Query("path"))
+
+		content, modTime, err := loadForEdit(ctx.Request, rc, remote, file)
+		if err != nil {
+			return sse.PatchTempl(templates.Toast("Cannot edit "+remote+":"+file+": "+err.Error(), true))
+		}
+		sse.PatchSignals(map[string]any{"_editor": map[string]any{
+			"content": content,
+			"modTime": modTime,
+			"hash":    contentHash(content),
+			"force":   false,
+		}})
+		return sse.PatchTempl(templates.EditorPanel(remote, file, ""))
+	})
+
+	// API: Save the editor's content back over the file, unless it changed
+	// on the remote since it was opened and the user has not chosen to
+	// overwrite it anyway.
+	r.POST("/api/edit/{remote}", func(ctx *router.Context) error {
+		var signals editorSignals
+		ctx.ReadSignals(&signals)
+		sse := ctx.SSE()
+		remote := ctx.Param("remote")
+		file := rpath.Clean(ctx.Query("path"))
+		ed := signals.Editor
+
+		if !ed.Force {
+			changed, err := changedSinceLoad(ctx.Request, rc, remote, file, ed.ModTime, ed.Hash)
+			if err != nil {
+				return sse.PatchTempl(templates.EditorStatus("Cannot check the file before saving: "+err.Error(), true))
+			}
+			if changed {
+				return sse.PatchTempl(templates.EditorConflict(remote, file))
+			}
+		}
+		if len(ed.Content) > editLimit {
+			return sse.PatchTempl(templates.EditorStatus("The file is larger than the "+formatSize(editLimit)+" editor limit", true))
+		}
+
+		err := rc.Upload(ctx.Request.Context(), remote, rpath.Parent(file), rpath.Base(file), strings.NewReader(ed.Content))
+		recordAudit(ctx, auditLog, audit.Entry{Action: "file.edit", Remote: remote, Path: file, Params: map[string]any{"bytes": len(ed.Content), "force": ed.Force}}, err)
+		if err != nil {
+			return sse.PatchTempl(templates.EditorStatus("Save failed: "+err.Error(), true))
+		}
+
+		modTime := ""
+		if item, err := rc.Stat(remote, file); err == nil && item != nil {
+			modTime = item.ModTime
+		}
+		sse.PatchSignals(map[string]any{"_editor": map[string]any{
+			"modTime": modTime,
+			"hash":    contentHash(ed.Content),
+			"force":   false,
+		}})
+		if err := patchFileBrowser(ctx, sse, listings, userPrefs, remote, rpath.Parent(file)); err != nil {
+			return err
+		}
+		return sse.PatchTempl(templates.Toast("Saved "+remote+":"+file, false))
+	})
+}
+
+// loadForEdit reads a whole text file for the editor, with its ModTime.
+func loadForEdit(req *http.Request, rc *rclone.Client, remote, file string) (content, modTime string, err error) {
+	item, err := rc.Stat(remote, file)
+	switch {
+	case err != nil:
+		return "", "", err
+	case item == nil:
+		return "", "", fmt.Errorf("the file no longer exists")
+	case item.IsDir:
+		return "", "", fmt.Errorf("it is a folder")
+	case item.Size > editLimit:
+		return "", "", fmt.Errorf("it is larger than the %s editor limit", formatSize(editLimit))
+	}
+	data, truncated, err := rc.ReadPrefix(req.Context(), remote, file, editLimit)
+	switch {
+	case err != nil:
+		return "", "", err
+	case truncated:
+		return "", "", fmt.Errorf("it is larger than the %s editor limit", formatSize(editLimit))
+	case !preview.IsText(data):
+		return "", "", fmt.Errorf("it is not a text file")
+	}
+	return string(data), item.ModTime, nil
+}
+
+// changedSinceLoad reports whether the file on the remote differs from the
+// version the editor loaded. An unchanged ModTime is trusted; otherwise the
+// content is read again and hashed, so a touch without an edit, or a
+// backend that rewrites ModTime, does not count as a conflict.
+func changedSinceLoad(req *http.Request, rc *rclone.Client, remote, file, modTime, hash string) (bool, error) {
+	item, err := rc.Stat(remote, file)
+	switch {
+	case err != nil:
+		return false, err
+	case item == nil || item.IsDir:
+		return true, nil
+	case item.ModTime == modTime:
+		return false, nil
+	}
+	current, _, err := loadForEdit(req, rc, remote, file)
+	if err != nil {
+		return true, nil
+	}
+	return contentHash(current) != hash, nil
+}
+
+// contentHash identifies a version of a file's content. It is computed
+// here rather than asked of the remote, since not every backend has one.
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/joeblew999/plat-rclone/pkg/audit"
+	"github.com/joeblew999/plat-rclone/pkg/datastar"
+	"github.com/joeblew999/plat-rclone/pkg/prefs"
+	"github.com/joeblew999/plat-rclone/pkg/rclone"
+	"github.com/joeblew999/plat-rclone/pkg/router"
+	"github.com/joeblew999/plat-rclone/pkg/rpath"
+	"github.com/joeblew999/plat-rclone/pkg/thumb"
+	"github.com/joeblew999/plat-rclone/pkg/trash"
+	"github.com/joeblew999/plat-rclone/templates"
+)
+
+// fileSignals are the file browser's inputs for folder operations.
+type fileSignals struct {
+	NewFolder   string `json:"newFolder"`
+	RenameTo    string `json:"renameTo"`
+	ConfirmName string `json:"confirmName"`
+}
+
+func registerFileRoutes(r *router.Router, rc *rclone.Client, trashBin *trash.Trash, auditLog *audit.Log, userPrefs *prefs.Store, listings *listingRuns) {
+	// API: Delete a file or folder (into the remote's trash, where it has one)
+	r.DELETE("/api/files/{remote}", func(ctx *router.Context) error {
+		sse := ctx.SSE()
+		remote := ctx.Param("remote")
+		path := rpath.Clean(ctx.Query("path"))
+
+		item, err := deleteItem(ctx, auditLog, trashBin, remote, path)
+		if err != nil {
+			return sse.PatchTempl(templates.Toast("Delete failed: "+err.Error(), true))
+		}
+
+		// Refresh the file browser
+		if err := patchFileBrowser(ctx, sse, listings, userPrefs, remote, rpath.Parent(path)); err != nil {
+			return err
+		}
+		if item == nil {
+			return sse.PatchTempl(templates.Toast("Deleted "+remote+":"+path+" permanently", false))
+		}
+		return sse.PatchTempl(templates.UndoToast("Moved "+remote+":"+item.Path+" to the trash", item.ID))
+	})
+
+	// Download a file. Range headers are honoured, so media players can
+	// seek and interrupted downloads can resume.
+	r.Download("/download/{remote}", func(w http.ResponseWriter, req *http.Request) {
+		remote := router.NewContext(w, req).Param("remote")
+		file := rpath.Clean(req.URL.Query().Get("path"))
+		disposition := "attachment"
+		if req.URL.Query().Get("inline") != "" {
+			disposition = "inline"
+			// Shown by the preview panel; HTML or SVG must not run as this site
+			w.Header().Set("Content-Security-Policy", "sandbox")
+		}
+		w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": rpath.Base(file)}))
+		if err := rc.ServeFile(w, req, remote, file); err != nil {
+			w.Header().Del("Content-Disposition")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+
+	// Download a folder as a zip archive, built while it is sent. The copy
+	// dialog's include and exclude rules decide which files go in, unless
+	// name picks items of the folder, as selected in the browser.
+	r.Download("/zip/{remote}", func(w http.ResponseWriter, req *http.Request) {
+		remote := router.NewContext(w, req).Param("remote")
+		query := req.URL.Query()
+		dir := rpath.Clean(query.Get("path"))
+
+		filter := filterRules(query.Get("include"), query.Get("exclude"))
+		names := query["name"]
+		if len(names) > 0 {
+			filter = map[string]any{"IncludeRule": rclone.NameRules(names)}
+		}
+		items, err := rc.ListFiles(remote, dir, filter)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		name := remote
+		if len(names) == 1 {
+			name = names[0]
+		} else if dir != "" {
+			name = rpath.Base(dir)
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".zip"}))
+		if err := writeZip(req.Context(), w, rc, remote, dir, items); err != nil {
+			log.Printf("zip %s:%s: %v", remote, dir, err)
+		}
+	})
+
+	// API: Create a folder in the browsed directory
+	r.POST("/api/files/{remote}/mkdir", func(ctx *router.Context) error {
+		var signals fileSignals
+		ctx.ReadSignals(&signals)
+		sse := ctx.SSE()
+		remote := ctx.Param("remote")
+		dir := rpath.Clean(ctx.Query("path"))
+
+		name := strings.TrimSpace(signals.NewFolder)
+		target := rpath.Join(dir, name)
+		err := validName(name)
+		if err == nil {
+			err = rc.Mkdir(remote, target)
+		}
+		recordAudit(ctx, auditLog, audit.Entry{Action: "dir.create", Remote: remote, Path: target}, err)
+		if err != nil {
+			return sse.PatchTempl(templates.Toast("Create folder failed: "+err.Error(), true))
+		}
+		if err := patchFileBrowser(ctx, sse, listings, userPrefs, remote, dir); err != nil {
+			return err
+		}
+		return sse.PatchTempl(templates.Toast("Created "+remote+":"+target, false))
+	})
+
+	// API: Rename a file or folder within its directory
+	r.POST("/api/files/{remote}/rename", func(ctx *router.Context) error {
+		var signals fileSignals
+		ctx.ReadSignals(&signals)
+		sse := ctx.SSE()
+		remote := ctx.Param("remote")
+		from := rpath.Clean(ctx.Query("path"))
+
+		name := strings.TrimSpace(signals.RenameTo)
+		to := rpath.Join(rpath.Parent(from), name)
+		err := validName(name)
+		if err == nil {
+			err = renameItem(rc, remote, from, to)
+		}
+		recordAudit(ctx, auditLog, audit.Entry{Action: "file.rename", Remote: remote, Path: from, Params: map[string]any{"to": to}}, err)
+		if err != nil {
+			return sse.PatchTempl(templates.Toast("Rename failed: "+err.Error(), true))
+		}
+		if err := patchFileBrowser(ctx, sse, listings, userPrefs, remote, rpath.Parent(from)); err != nil {
+			return err
+		}
+		return sse.PatchTempl(templates.Toast("Renamed to "+remote+":"+to, false))
+	})
+
+	// API: Permanently delete a folder and everything in it. The folder's
+	// name must be typed back as confirmation.
+	r.POST("/api/files/{remote}/purge", func(ctx *router.Context) error {
+		var signals fileSignals
+		ctx.ReadSignals(&signals)
+		sse := ctx.SSE()
+		remote := ctx.Param("remote")
+		dir := rpath.Clean(ctx.Query("path"))
+
+		if dir == "" || signals.ConfirmName != rpath.Base(dir) {
+			return sse.PatchTempl(templates.Toast("Purge cancelled: the typed name did not match "+rpath.Base(dir), true))
+		}
+		err := rc.Purge(remote, dir)
+		recordAudit(ctx, auditLog, audit.Entry{Action: "dir.purge", Remote: remote, Path: dir}, err)
+		if err != nil {
+			return sse.PatchTempl(templates.Toast("Purge failed: "+err.Error(), true))
+		}
+		if err := patchFileBrowser(ctx, sse, listings, userPrefs, remote, rpath.Parent(dir)); err != nil {
+			return err
+		}
+		return sse.PatchTempl(templates.Toast("Purged "+remote+":"+dir, false))
+	})
+
+	// API: Remove empty folders below the browsed directory
+	r.POST("/api/files/{remote}/rmdirs", func(ctx *router.Context) error {
+		sse := ctx.SSE()
+		remote := ctx.Param("remote")
+		dir := rpath.Clean(ctx.Query("path"))
+
+		err := rc.Rmdirs(remote, dir, true)
+		recordAudit(ctx, auditLog, audit.Entry{Action: "dir.rmdirs", Remote: remote, Path: dir}, err)
+		if err != nil {
+			return sse.PatchTempl(templates.Toast("Remove empty folders failed: "+err.Error(), true))
+		}
+		if err := patchFileBrowser(ctx, sse, listings, userPrefs, remote, dir); err != nil {
+			return err
+		}
+		return sse.PatchTempl(templates.Toast("Removed empty folders below "+remote+":"+dir, false))
+	})
+}
+
+// deleteItem moves remote:path into the remote's trash, or deletes it for
+// good where there is none, and records it in auditLog. The item is
+// nil if nothing was kept.
+func deleteItem(ctx *router.Context, auditLog *audit.Log, trashBin *trash.Trash, remote, path string) (*trash.Item, error) {
+	item, err := trashBin.Delete(remote, path)
+	action := "file.delete"
+	if item != nil {
+		action = "file.trash"
+	}
+	recordAudit(ctx, auditLog, audit.Entry{Action: action, Remote: remote, Path: path}, err)
+	return item, err
+}
+
+// renameItem moves from to to on the same remote, refusing to overwrite.
+// rclone uses a server-side move whenever the backend supports one.
+func renameItem(rc *rclone.Client, remote, from, to string) error {
+	if from == to {
+		return nil
+	}
+	src, err := rc.Stat(remote, from)
+	if err != nil {
+		return err
+	}
+	if src == nil {
+		return fmt.Errorf("%s:%s not found", remote, from)
+	}
+	if dst, err := rc.Stat(remote, to); err != nil {
+		return err
+	} else if dst != nil {
+		return fmt.Errorf("%s:%s already exists", remote, to)
+	}
+	if !src.IsDir {
+		return rc.MoveFile(remote, from, remote, to)
+	}
+	if err := rc.MoveDir(remote, from, remote, to); err != nil {
+		return err
+	}
+	// Some backends keep the emptied top directory after sync/move
+	rc.Rmdir(remote, from)
+	return nil
+}
+
+// validName checks a single path element typed into the browser.
+func validName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("name is required")
+	case name == "." || name == "..":
+		return fmt.Errorf("%q is not a valid name", name)
+	case strings.ContainsAny(name, "/\\"):
+		return fmt.Errorf("name must not contain slashes")
+	case strings.ContainsFunc(name, func(r rune) bool { return r < 0x20 || r == 0x7f }):
+		return fmt.Errorf("name must not contain control characters")
+	}
+	return nil
+}
+
+// patchFileBrowser lists path on remote into the file browser, laid out
+// as the requesting user prefers in userPrefs.
+func patchFileBrowser(ctx *router.Context, sse *datastar.SSE, listings *listingRuns, userPrefs *prefs.Store, remote, path string) error {
+	path = rpath.Clean(path)
+	view := browserPrefs(ctx, userPrefs)
+	items, state, err := firstPage(ctx, listings, remote, path, view, "")
+	if err != nil {
+		return sse.PatchHTMLByID("file-browser", `<div class="error">`+html.EscapeString(err.Error())+`</div>`)
+	}
+	return sse.PatchTempl(templates.FileBrowser(remote, path, items, listingView(view), state))
+}
+
+// fileItems converts listed entries for the file browser.
+func fileItems(items []rclone.ListItem) []templates.FileItem {
+	fileItems := make([]templates.FileItem, len(items))
+	for i, item := range items {
+		fileItems[i] = templates.FileItem{
+			Name:     item.Name,
+			Size:     formatSize(item.Size),
+			ModTime:  item.ModTime,
+			IsDir:    item.IsDir,
+			Editable: editable(item),
+			Thumb:    !item.IsDir && thumb.Supported(item.Name),
+			MimeType: item.MimeType,
+			Hash:     preferredHash(item.Hashes),
+			Tier:     item.Tier,
+			ID:       item.ID,
+		}
+	}
+	return fileItems
+}
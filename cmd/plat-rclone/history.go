@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/joeblew999/plat-rclone/pkg/history"
+	"github.com/joeblew999/plat-rclone/pkg/router"
+	"github.com/joeblew999/plat-rclone/templates"
+)
+
+// historyLimit caps how many records the history view renders.
+const historyLimit = 100
+
+func registerHistoryRoutes(r *router.Router, tracker *history.Tracker) {
+	// API: Search job history
+	r.GET("/api/jobs/history", func(ctx *router.Context) error {
+		var signals struct {
+			HistoryQuery string `json:"historyQuery"`
+		}
+		ctx.ReadSignals(&signals)
+		sse := ctx.SSE()
+
+		entries, err := getHistoryInfo(tracker, signals.HistoryQuery)
+		if err != nil {
+			return sse.PatchHTMLByID("job-history", `<div id="job-history" class="error">`+err.Error()+`</div>`)
+		}
+		return sse.PatchTempl(templates.HistoryList(entries))
+	})
+}
+
+func getHistoryInfo(tracker *history.Tracker, query string) ([]templates.HistoryEntry, error) {
+	records, err := tracker.Store().Search(query, historyLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]templates.HistoryEntry, len(records))
+	for i, rec := range records {
+		entry := templates.HistoryEntry{
+			Key:       rec.Key,
+			JobID:     rec.JobID,
+			Group:     rec.Group,
+			Started:   rec.StartTime.Local().Format("2006-01-02 15:04:05"),
+			Duration:  rec.Duration().Round(time.Second).String(),
+			Bytes:     formatSize(rec.Bytes),
+			Transfers: rec.Transfers,
+			Errors:    rec.Errors,
+			Status:    rec.Status(),
+			Error:     rec.Error,
+		}
+		if t := rec.Transfer; t != nil {
+			entry.Operation = describeTransfer(*t)
+		}
+		entry.Details = statsDetails(rec.Stats)
+		entries[i] = entry
+	}
+	return entries, nil
+}
+
+// statsDetails flattens the scalar values of a core/stats result for display.
+func statsDetails(stats map[string]any) []templates.HistoryDetail {
+	var details []templates.HistoryDetail
+	for key, v := range stats {
+		switch v := v.(type) {
+		case float64:
+			value := fmt.Sprint(v)
+			if strings.Contains(strings.ToLower(key), "bytes") || key == "speed" {
+				value = formatSize(int64(v))
+			}
+			details = append(details, templates.HistoryDetail{Label: key, Value: value})
+		case bool, string:
+			details = append(details, templates.HistoryDetail{Label: key, Value: fmt.Sprint(v)})
+		}
+	}
+	sort.Slice(details, func(i, j int) bool {
+		return details[i].Label < details[j].Label
+	})
+	return details
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joeblew999/plat-rclone/pkg/prefs"
+	"github.com/joeblew999/plat-rclone/pkg/rclone"
+	"github.com/joeblew999/plat-rclone/pkg/router"
+	"github.com/joeblew999/plat-rclone/pkg/rpath"
+	"github.com/joeblew999/plat-rclone/templates"
+)
+
+// listingSignals are the file browser's layout controls and filter box.
+type listingSignals struct {
+	Listing struct {
+		Sort      string `json:"sort"`
+		Desc      bool   `json:"desc"`
+		DirsFirst bool   `json:"dirsFirst"`
+		Gallery   bool   `json:"gallery"`
+		Mime      bool   `json:"mime"`
+		Hash      bool   `json:"hash"`
+		Tier      bool   `json:"tier"`
+		ID        bool   `json:"id"`
+	} `json:"listing"`
+	Filter    string `json:"filter"`
+	Selection struct {
+		Listing string `json:"listing"` // the ID of the listing shown
+	} `json:"selection"`
+}
+
+// browser converts the signals into saved settings.
+func (s listingSignals) browser() prefs.Browser {
+	l := s.Listing
+	b := prefs.Browser{Sort: l.Sort, Desc: l.Desc, DirsFirst: l.DirsFirst, Gallery: l.Gallery}
+	for col, on := range map[string]bool{"mime": l.Mime, "hash": l.Hash, "tier": l.Tier, "id": l.ID} {
+		if on {
+			b.Columns = append(b.Columns, col)
+		}
+	}
+	return b.Normalize()
+}
+
+func registerListingRoutes(r *router.Router, listings *listingRuns, userPrefs *prefs.Store) {
+	// API: Re-list the browsed directory as the layout controls and filter
+	// box say, without saving anything. The filter box calls this as you
+	// type.
+	r.GET("/api/files/{remote}/listing", func(ctx *router.Context) error {
+		var signals listingSignals
+		ctx.ReadSignals(&signals)
+		return patchListing(ctx, listings, signals.browser(), signals.Filter, signals.Selection.Listing)
+	})
+
+	// API: Change the file browser's layout and remember it for the user
+	r.POST("/api/files/{remote}/listing", func(ctx *router.Context) error {
+		var signals listingSignals
+		ctx.ReadSignals(&signals)
+		view := signals.browser()
+		if userPrefs != nil {
+			if err := userPrefs.SetBrowser(requestUser(ctx.Request), view); err != nil {
+				log.Printf("prefs: %v", err)
+			}
+		}
+		return patchListing(ctx, listings, view, signals.Filter, signals.Selection.Listing)
+	})
+
+	// API: Follow a listing's progress until it ends. Leaving the page
+	// ends this request, which stops the listing too.
+	r.GET("/api/listings/{id}", func(ctx *router.Context) error {
+		sse := ctx.SSE()
+		run := listings.get(ctx.Param("id"))
+		if run == nil {
+			return nil
+		}
+		done := ctx.Request.Context().Done()
+		for {
+			changed, state := run.progress()
+			if state.Done {
+				break
+			}
+			sse.PatchTempl(templates.ListingStatus(state))
+			select {
+			case <-changed:
+			case <-done:
+				run.stop()
+				return nil
+			}
+			select {
+			case <-time.After(listingTick):
+			case <-done:
+				run.stop()
+				return nil
+			}
+		}
+
+		// A listing replaced by another is no longer on the page
+		if listings.get(run.id) == nil {
+			return nil
+		}
+
+		// The page was shown in the order entries came; sorting them all
+		// at the end may have moved some
+		shown, reorder, state := run.result()
+		if reorder {
+			return sse.PatchTempl(templates.FileListing(run.remote, run.dir, fileItems(shown), listingView(run.view), run.filter, state))
+		}
+		sse.PatchTempl(templates.ListingMore(state))
+		return sse.PatchTempl(templates.ListingStatus(state))
+	})
+
+	// API: Stop a listing; what it has listed stays browsable
+	r.POST("/api/listings/{id}/cancel", func(ctx *router.Context) error {
+		ctx.SSE()
+		if run := listings.get(ctx.Param("id")); run != nil {
+			run.stop()
+		}
+		return nil
+	})
+
+	// API: Add the next page of a listing, as it is scrolled to the bottom
+	r.GET("/api/listings/{id}/more", func(ctx *router.Context) error {
+		sse := ctx.SSE()
+		run := listings.get(ctx.Param("id"))
+		if run == nil {
+			return sse.PatchTempl(templates.Toast("This listing has expired; open the folder again", true))
+		}
+		from, _ := strconv.Atoi(ctx.Query("from"))
+		page, state, ok := run.take(ctx.Request.Context(), from, 1)
+		if !ok {
+			return nil
+		}
+		items := fileItems(page)
+		view := listingView(run.view)
+		sse.AppendTemplByID("file-rows", templates.FileRows(run.remote, run.dir, items, view))
+		sse.AppendTemplByID("file-gallery", templates.GalleryTiles(run.remote, run.dir, items))
+		return sse.PatchTempl(templates.ListingMore(state))
+	})
+}
+
+// patchListing replaces the file table and gallery, leaving the controls
+// above them, and the filter box being typed in, alone. The listing with
+// ID shown, which the new one replaces, is ended.
+func patchListing(ctx *router.Context, listings *listingRuns, view prefs.Browser, filter, shown string) error {
+	sse := ctx.SSE()
+	remote := ctx.Param("remote")
+	dir := rpath.Clean(ctx.Query("path"))
+	listings.end(shown)
+	items, state, err := firstPage(ctx, listings, remote, dir, view, filter)
+	if err != nil {
+		return sse.PatchTempl(templates.Toast("Listing failed: "+err.Error(), true))
+	}
+	return sse.PatchTempl(templates.FileListing(remote, dir, items, listingView(view), filter, state))
+}
+
+// firstPage starts listing dir for the file browser and returns its first
+// page. The rest streams in the background, for the page to follow and
+// scroll through. A listing that fails before it finds anything is an
+// error.
+func firstPage(ctx *router.Context, listings *listingRuns, remote, dir string, view prefs.Browser, filter string) ([]templates.FileItem, templates.ListingState, error) {
+	run := listings.start(remote, dir, view, filter)
+	page, state, ok := run.take(ctx.Request.Context(), 0, 0)
+	if !ok {
+		run.stop()
+		return nil, state, ctx.Request.Context().Err()
+	}
+	if state.Done && state.Err != "" && state.Listed == 0 {
+		return nil, state, errors.New(state.Err)
+	}
+	return fileItems(page), state, nil
+}
+
+// browserPrefs returns the requesting user's file browser settings from
+// userPrefs; with no store, everyone gets the defaults.
+func browserPrefs(ctx *router.Context, userPrefs *prefs.Store) prefs.Browser {
+	if userPrefs == nil {
+		return prefs.DefaultBrowser
+	}
+	return userPrefs.Browser(requestUser(ctx.Request))
+}
+
+// requestUser is who made the request, as far as we can tell: the name
+// given for HTTP basic auth, usually by a proxy in front of plat-rclone.
+func requestUser(req *http.Request) string {
+	user, _, _ := req.BasicAuth()
+	return user
+}
+
+func listingView(b prefs.Browser) templates.ListingView {
+	return templates.ListingView{
+		Sort:      b.Sort,
+		Desc:      b.Desc,
+		DirsFirst: b.DirsFirst,
+		Gallery:   b.Gallery,
+		Columns:   b.Columns,
+	}
+}
+
+// itemOrder orders a listing as view says. Ties fall back to the name, so
+// the order is stable between listings.
+func itemOrder(view prefs.Browser) func(a, b rclone.ListItem) int {
+	byKey := func(a, b rclone.ListItem) int {
+		switch view.Sort {
+		case "size":
+			return cmp.Compare(a.Size, b.Size)
+		case "modtime":
+			return parseModTime(a.ModTime).Compare(parseModTime(b.ModTime))
+		case "type":
+			return cmp.Compare(strings.ToLower(path.Ext(a.Name)), strings.ToLower(path.Ext(b.Name)))
+		}
+		return 0
+	}
+	return func(a, b rclone.ListItem) int {
+		if view.DirsFirst && a.IsDir != b.IsDir {
+			if a.IsDir {
+				return -1
+			}
+			return 1
+		}
+		c := byKey(a, b)
+		if c == 0 {
+			c = cmp.Or(cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)), cmp.Compare(a.Name, b.Name))
+		}
+		if view.Desc {
+			return -c
+		}
+		return c
+	}
+}
+
+// parseModTime reads a listing's RFC 3339 ModTime; bad ones sort first.
+func parseModTime(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, s)
+	return t
+}
+
+// preferredHash picks the hash shown in the hash column: MD5 or SHA-1
+// where the backend has them, as those are what people compare against.
+func preferredHash(hashes map[string]string) string {
+	for _, name := range []string{"md5", "sha1"} {
+		if h := hashes[name]; h != "" {
+			return name + ":" + h
+		}
+	}
+	names := make([]string, 0, len(hashes))
+	for name := range hashes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if hashes[name] != "" {
+			return name + ":" + hashes[name]
+		}
+	}
+	return ""
+}
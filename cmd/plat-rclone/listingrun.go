@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joeblew999/plat-rclone/pkg/prefs"
+	"github.com/joeblew999/plat-rclone/pkg/rclone"
+	"github.com/joeblew999/plat-rclone/templates"
+)
+
+const (
+	// listingPage is how many entries the file browser shows at first, and
+	// adds each time it is scrolled to the bottom.
+	listingPage = 200
+	// listingWait is how long a page waits to fill before it is shown with
+	// what there is, so a filter matching little still shows progress.
+	listingWait = time.Second
+	// listingTick is how often the entry count is updated while listing.
+	listingTick = 250 * time.Millisecond
+	// listingIdle is how long an unused listing is kept for paging.
+	listingIdle = 10 * time.Minute
+)
+
+// listingRun is one folder listed for the file browser. Entries stream in
+// from rclone and are kept here; the page only gets the rows it scrolls to.
+type listingRun struct {
+	id     string
+	remote string
+	dir    string
+	view   prefs.Browser
+	filter string
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	items   []rclone.ListItem // matching the filter; sorted once the listing ends
+	listed  int
+	shown   int  // entries sent to the page
+	reorder bool // sorting at the end moved entries already shown
+	done    bool
+	stopped bool
+	err     error
+	used    time.Time
+	changed chan struct{} // closed when entries arrive or the listing ends
+}
+
+// listingRuns holds the running and recently finished listings by ID.
+type listingRuns struct {
+	rc *rclone.Client
+
+	mu   sync.Mutex
+	runs map[string]*listingRun
+}
+
+func newListingRuns(rc *rclone.Client) *listingRuns {
+	return &listingRuns{rc: rc, runs: map[string]*listingRun{}}
+}
+
+// start lists dir on remote in the background, keeping the entries whose
+// names contain filter.
+func (l *listingRuns) start(remote, dir string, view prefs.Browser, filter string) *listingRun {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := make([]byte, 8)
+	rand.Read(b)
+	run := &listingRun{
+		id:      hex.EncodeToString(b),
+		remote:  remote,
+		dir:     dir,
+		view:    view,
+		filter:  filter,
+		cancel:  cancel,
+		used:    time.Now(),
+		changed: make(chan struct{}),
+	}
+
+	l.mu.Lock()
+	for id, old := range l.runs {
+		if old.idle() > listingIdle {
+			old.cancel()
+			delete(l.runs, id)
+		}
+	}
+	l.runs[run.id] = run
+	l.mu.Unlock()
+
+	go run.list(ctx, l.rc)
+	return run
+}
+
+// end stops the listing with id and drops it, once another has replaced
+// it on the page. Typing in the filter box starts a listing per pause,
+// and only the last is wanted.
+func (l *listingRuns) end(id string) {
+	l.mu.Lock()
+	run := l.runs[id]
+	delete(l.runs, id)
+	l.mu.Unlock()
+	if run != nil {
+		run.stop()
+	}
+}
+
+// get returns the listing with id, or nil once it has been dropped.
+func (l *listingRuns) get(id string) *listingRun {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.runs[id]
+}
+
+func (r *listingRun) list(ctx context.Context, rc *rclone.Client) {
+	var opt map[string]any
+	if slices.Contains(r.view.Columns, "hash") {
+		opt = map[string]any{"showHash": true}
+	}
+	filter := strings.ToLower(strings.TrimSpace(r.filter))
+	err := rc.ListStream(ctx, r.remote, r.dir, opt, nil, func(item rclone.ListItem) error {
+		// Not every backend notices a cancelled listing by itself
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.listed++
+		if filter == "" || strings.Contains(strings.ToLower(item.Name), filter) {
+			r.items = append(r.items, item)
+		}
+		if r.listed%100 == 0 {
+			r.notify()
+		}
+		return nil
+	})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	order := itemOrder(r.view)
+	if !slices.IsSortedFunc(r.items, order) {
+		slices.SortStableFunc(r.items, order)
+		r.reorder = r.shown > 0
+	}
+	r.done = true
+	if ctx.Err() != nil {
+		r.stopped = true
+	} else if err != nil {
+		r.err = err
+	}
+	r.notify()
+}
+
+// notify wakes everyone waiting for entries. r.mu must be held.
+func (r *listingRun) notify() {
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// stop cancels the listing, keeping what it has listed.
+func (r *listingRun) stop() {
+	r.cancel()
+}
+
+func (r *listingRun) idle() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return time.Since(r.used)
+}
+
+// state reports progress. r.mu must be held.
+func (r *listingRun) state() templates.ListingState {
+	s := templates.ListingState{
+		ID:      r.id,
+		Listed:  r.listed,
+		Matched: len(r.items),
+		Shown:   r.shown,
+		Done:    r.done,
+		Stopped: r.stopped,
+	}
+	if r.err != nil {
+		s.Err = r.err.Error()
+	}
+	return s
+}
+
+// progress returns the listing's state, and a channel closed when it
+// next changes.
+func (r *listingRun) progress() (<-chan struct{}, templates.ListingState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.used = time.Now()
+	return r.changed, r.state()
+}
+
+// take waits for the page of entries after the first from, then marks it
+// shown. It settles for fewer once the listing ends, or after listingWait
+// if it has at least least entries. ok is false if the page no longer
+// starts at from, because it was taken already.
+func (r *listingRun) take(ctx context.Context, from, least int) (page []rclone.ListItem, state templates.ListingState, ok bool) {
+	deadline := time.After(listingWait)
+	patient := true
+	for {
+		r.mu.Lock()
+		if r.shown != from {
+			r.mu.Unlock()
+			return nil, templates.ListingState{}, false
+		}
+		avail := len(r.items) - r.shown
+		if ctx.Err() == nil && (r.done || avail >= listingPage || (!patient && avail >= least)) {
+			n := min(avail, listingPage)
+			page = slices.Clone(r.items[r.shown : r.shown+n])
+			r.shown += n
+			r.used = time.Now()
+			state = r.state()
+			r.mu.Unlock()
+			return page, state, true
+		}
+		changed := r.changed
+		r.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-deadline:
+			patient = false
+		case <-ctx.Done():
+			return nil, templates.ListingState{}, false
+		}
+	}
+}
+
+// result returns the entries shown, once the listing has ended, and
+// whether sorting them changed their order on the page.
+func (r *listingRun) result() (shown []rclone.ListItem, reorder bool, state templates.ListingState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reorder, r.reorder = r.reorder, false
+	return slices.Clone(r.items[:r.shown]), reorder, r.state()
+}
@@ -1,23 +1,49 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/joeblew999/plat-rclone/pkg/audit"
 	"github.com/joeblew999/plat-rclone/pkg/datastar"
+	"github.com/joeblew999/plat-rclone/pkg/history"
+	"github.com/joeblew999/plat-rclone/pkg/notify"
+	"github.com/joeblew999/plat-rclone/pkg/prefs"
+	"github.com/joeblew999/plat-rclone/pkg/profiles"
+	"github.com/joeblew999/plat-rclone/pkg/queue"
 	"github.com/joeblew999/plat-rclone/pkg/rclone"
 	"github.com/joeblew999/plat-rclone/pkg/router"
+	"github.com/joeblew999/plat-rclone/pkg/rpath"
+	"github.com/joeblew999/plat-rclone/pkg/scheduler"
+	"github.com/joeblew999/plat-rclone/pkg/stats"
+	"github.com/joeblew999/plat-rclone/pkg/thumb"
+	"github.com/joeblew999/plat-rclone/pkg/trash"
+	"github.com/joeblew999/plat-rclone/pkg/usage"
 	"github.com/joeblew999/plat-rclone/templates"
 )
 
 var (
-	addr       = ":8080"
-	rcloneURL  = "http://localhost:5572"
-	rcloneUser = ""
-	rclonePass = ""
-	embedded   = false
+	addr         = ":8080"
+	rcloneURL    = "http://localhost:5572"
+	rcloneUser   = ""
+	rclonePass   = ""
+	embedded     = false
+	dataDir      = defaultDataDir()
+	maxJobs      = 4
+	maxPerRemote = 2
+	trashDirs    = trash.DefaultDir
+	trashDays    = 30
+	historyDays  = 90
+	historyMax   = 10000
+	maxUploadMB  = 2048
+	thumbCacheMB = 512
 )
 
 func main() {
@@ -54,10 +80,34 @@ Commands:
 
 Options for serve:
   -addr      HTTP server address (default ":8080")
-  -rclone    rclone RC API URL (default "http://localhost:5572")
+  -rclone    rclone RC API URL (default "http://localhost:5572");
+             start rcd with --rc-serve to enable file downloads
   -user      rclone RC username
   -pass      rclone RC password
   -embedded  Use embedded rclone (no external daemon needed)
+  -data      Directory for plat-rclone state (job history, tasks, profiles,
+             notification channels, audit log, trash index, thumbnails,
+             preferences)
+             (default: <user config dir>/plat-rclone)
+  -max-jobs  Transfers run at once; more wait in the queue (default 4, 0 = no limit)
+  -max-per-remote
+             Transfers run at once per remote (default 2, 0 = no limit)
+  -trash-dir Trash folder for deletes from the browser, relative to each
+             remote's root (default ".plat-rclone-trash"). Comma-separate
+             remote=dir entries to override it per remote; "remote=" makes
+             deletes on that remote permanent.
+  -trash-days
+             Days deleted items stay in the trash (default 30, 0 = forever)
+  -history-days
+             Days finished jobs stay in the job history (default 90, 0 = forever)
+  -history-max
+             Most jobs kept in the job history (default 10000, 0 = no limit)
+  -max-upload
+             Largest browser upload accepted, in MiB, counting files
+             sent together as one (default 2048, 0 = no limit)
+  -thumb-cache
+             Disk space for cached image thumbnails, in MiB
+             (default 512, 0 = no limit)
 
 Examples:
   plat-rclone                      # Start web server on :8080
@@ -96,6 +146,51 @@ func parseFlags() {
 			}
 		case "-embedded":
 			embedded = true
+		case "-data":
+			if i+1 < len(args) {
+				dataDir = args[i+1]
+				i++
+			}
+		case "-max-jobs":
+			if i+1 < len(args) {
+				maxJobs, _ = strconv.Atoi(args[i+1])
+				i++
+			}
+		case "-max-per-remote":
+			if i+1 < len(args) {
+				maxPerRemote, _ = strconv.Atoi(args[i+1])
+				i++
+			}
+		case "-trash-dir":
+			if i+1 < len(args) {
+				trashDirs = args[i+1]
+				i++
+			}
+		case "-trash-days":
+			if i+1 < len(args) {
+				trashDays, _ = strconv.Atoi(args[i+1])
+				i++
+			}
+		case "-history-days":
+			if i+1 < len(args) {
+				historyDays, _ = strconv.Atoi(args[i+1])
+				i++
+			}
+		case "-history-max":
+			if i+1 < len(args) {
+				historyMax, _ = strconv.Atoi(args[i+1])
+				i++
+			}
+		case "-max-upload":
+			if i+1 < len(args) {
+				maxUploadMB, _ = strconv.Atoi(args[i+1])
+				i++
+			}
+		case "-thumb-cache":
+			if i+1 < len(args) {
+				thumbCacheMB, _ = strconv.Atoi(args[i+1])
+				i++
+			}
 		}
 	}
 }
@@ -123,7 +218,7 @@ func cmdDownload() {
 
 	fmt.Printf("rclone installed to: %s\n", path)
 	fmt.Println("\nTo start rclone RC server:")
-	fmt.Printf("  %s rcd --rc-no-auth\n", path)
+	fmt.Printf("  %s rcd --rc-no-auth --rc-serve\n", path)
 }
 
 func getOS() string {
@@ -160,6 +255,13 @@ func fileExists(path string) bool {
 	return err == nil
 }
 
+func defaultDataDir() string {
+	if dir, err := os.UserConfigDir(); err == nil {
+		return filepath.Join(dir, "plat-rclone")
+	}
+	return ".plat-rclone"
+}
+
 func cmdServe() {
 	// Create rclone client
 	var rc *rclone.Client
@@ -174,6 +276,89 @@ func cmdServe() {
 		}
 	}
 
+	// Job history survives restarts of both plat-rclone and rclone
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		log.Fatalf("Failed to create data directory: %v", err)
+	}
+	store, err := history.Open(filepath.Join(dataDir, "history.db"))
+	if err != nil {
+		log.Fatalf("Failed to open job history: %v", err)
+	}
+	defer store.Close()
+	store.MaxAge = time.Duration(historyDays) * 24 * time.Hour
+	store.MaxRecords = historyMax
+	tracker := history.NewTracker(rc, store)
+
+	// Notifications fire when the tracker first sees a job finished
+	channels, err := notify.Open(filepath.Join(dataDir, "notifications.yaml"))
+	if err != nil {
+		log.Fatalf("Failed to load notification channels: %v", err)
+	}
+	notifier := notify.New(channels)
+	tracker.OnFinish = func(rec history.Record) {
+		notifier.Notify(notify.FromRecord(rec))
+	}
+	go tracker.Run(context.Background(), 5*time.Second)
+
+	// Every mutating request is recorded in the audit log
+	auditLog, err := audit.Open(filepath.Join(dataDir, "audit"))
+	if err != nil {
+		log.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer auditLog.Close()
+
+	// Transfers wait in the queue until a slot is free
+	q := queue.New(rc, maxJobs, maxPerRemote)
+	q.OnStart = func(jobID int64, t rclone.Transfer) {
+		recordStarted(tracker, jobID, t)
+	}
+	go q.Run(context.Background(), 2*time.Second)
+
+	// Scheduled tasks go through the same queue
+	sched, err := scheduler.Open(filepath.Join(dataDir, "tasks.db"), rc)
+	if err != nil {
+		log.Fatalf("Failed to open task scheduler: %v", err)
+	}
+	defer sched.Close()
+	sched.Queue = q
+	if err := sched.Start(); err != nil {
+		log.Fatalf("Failed to start task scheduler: %v", err)
+	}
+
+	// Throughput samples for the stats charts, kept in memory for a day
+	sampler := stats.NewSampler(rc, 5*time.Second, 24*time.Hour)
+	go sampler.Run(context.Background())
+
+	// Browser deletes go to a per-remote trash, emptied after trashDays
+	trashBin, err := trash.Open(filepath.Join(dataDir, "trash.db"), rc)
+	if err != nil {
+		log.Fatalf("Failed to open trash index: %v", err)
+	}
+	defer trashBin.Close()
+	trashBin.Dir, trashBin.Dirs = trash.ParseDirs(trashDirs)
+	trashBin.Retention = time.Duration(trashDays) * 24 * time.Hour
+	go trashBin.Run(context.Background(), time.Hour)
+
+	// Image thumbnails for the preview panel and gallery, made once
+	thumbs, err := thumb.OpenCache(filepath.Join(dataDir, "thumbs"), int64(thumbCacheMB)<<20)
+	if err != nil {
+		log.Fatalf("Failed to open thumbnail cache: %v", err)
+	}
+	go thumbs.Run(context.Background(), time.Hour)
+
+	// Per-user view settings, such as the file browser's sort order
+	userPrefs, err := prefs.Open(filepath.Join(dataDir, "prefs.yaml"))
+	if err != nil {
+		log.Fatalf("Failed to load preferences: %v", err)
+	}
+	// Folders being listed for the file browser, kept for paging
+	listings := newListingRuns(rc)
+
+	profileStore, err := profiles.Open(filepath.Join(dataDir, "profiles.yaml"))
+	if err != nil {
+		log.Fatalf("Failed to load transfer profiles: %v", err)
+	}
+
 	// Create router
 	r := router.New()
 
@@ -190,13 +375,15 @@ func cmdServe() {
 	})
 
 	r.Page("/jobs", func(ctx *router.Context) (string, error) {
-		jobs, _ := getJobsInfo(rc)
-		return datastar.RenderTempl(templates.JobsPage(jobs))
+		group := ctx.Query("group")
+		jobs, _ := getJobsInfo(rc, group)
+		entries, _ := getHistoryInfo(tracker, "")
+		return datastar.RenderTempl(templates.JobsPage(jobs, group, getQueueInfo(q), entries))
 	})
 
 	r.Page("/stats", func(ctx *router.Context) (string, error) {
 		stats, version := getStatsInfo(rc)
-		return datastar.RenderTempl(templates.StatsPage(stats, version))
+		return datastar.RenderTempl(templates.StatsPage(stats, version, getChartsInfo(sampler, "5m")))
 	})
 
 	// API: Refresh remotes list
@@ -212,30 +399,28 @@ func cmdServe() {
 	// API: Browse remote
 	r.GET("/api/remotes/{name}/browse", func(ctx *router.Context) error {
 		sse := ctx.SSE()
-		name := ctx.Param("name")
-		path := ctx.Query("path")
+		return patchFileBrowser(ctx, sse, listings, userPrefs, ctx.Param("name"), ctx.Query("path"))
+	})
 
-		// Handle parent directory
-		if path == ".." {
-			path = ""
+	// Bookmarkable folder pages; the browser's in-place navigation pushes
+	// these URLs onto the history.
+	r.Page("/browse/*", func(ctx *router.Context) (string, error) {
+		remote, path, ok := rpath.ParseBrowse(ctx.Request.URL.EscapedPath())
+		if !ok {
+			ctx.Redirect("/")
+			return "", nil
 		}
-
-		items, err := rc.List(name, path)
+		remotes, err := getRemotesInfo(rc)
 		if err != nil {
-			return sse.PatchHTMLByID("file-browser", `<div class="error">`+err.Error()+`</div>`)
+			remotes = []templates.RemoteInfo{}
 		}
-
-		fileItems := make([]templates.FileItem, len(items))
-		for i, item := range items {
-			fileItems[i] = templates.FileItem{
-				Name:    item.Name,
-				Size:    formatSize(item.Size),
-				ModTime: item.ModTime,
-				IsDir:   item.IsDir,
-			}
+		view := browserPrefs(ctx, userPrefs)
+		items, state, err := firstPage(ctx, listings, remote, path, view, "")
+		errMsg := ""
+		if err != nil {
+			errMsg = err.Error()
 		}
-
-		return sse.PatchTempl(templates.FileBrowser(name, path, fileItems))
+		return datastar.RenderTempl(templates.BrowsePage(remotes, remote, path, items, listingView(view), state, errMsg))
 	})
 
 	// API: Delete remote
@@ -243,7 +428,9 @@ func cmdServe() {
 		sse := ctx.SSE()
 		name := ctx.Param("name")
 
-		if err := rc.DeleteRemote(name); err != nil {
+		err := rc.DeleteRemote(name)
+		recordAudit(ctx, auditLog, audit.Entry{Action: "remote.delete", Remote: name}, err)
+		if err != nil {
 			return sse.PatchHTMLByID("remotes-list", `<div class="error">`+err.Error()+`</div>`)
 		}
 
@@ -251,24 +438,41 @@ func cmdServe() {
 		return sse.RemoveByID("remote-" + name)
 	})
 
-	// API: Delete file
-	r.DELETE("/api/files/{remote}", func(ctx *router.Context) error {
+	// API: Queue a copy/sync/move from the file browser
+	r.POST("/api/transfers", func(ctx *router.Context) error {
+		var signals struct {
+			Transfer transferSignals `json:"transfer"`
+			Priority string          `json:"priority"`
+		}
+		err := ctx.ReadSignals(&signals)
 		sse := ctx.SSE()
-		remote := ctx.Param("remote")
-		path := ctx.Query("path")
+		if err != nil {
+			return sse.PatchHTMLByID("transfer-status", `<div id="transfer-status" class="error">`+err.Error()+`</div>`)
+		}
 
-		if err := rc.Delete(remote, path); err != nil {
-			return sse.ExecuteScript(`alert("Error: ` + err.Error() + `")`)
+		t, err := signals.Transfer.transfer()
+		if err != nil {
+			return sse.PatchHTMLByID("transfer-status", `<div id="transfer-status" class="error">`+err.Error()+`</div>`)
+		}
+		if t.Group == "" {
+			t.Group = t.Op + ":" + t.SrcRemote
 		}
 
-		// Refresh the file browser
-		return sse.Redirect("/api/remotes/" + remote + "/browse")
+		status, err := submitTransfer(q, t, parsePriority(signals.Priority), "browser", "transfer-status")
+		params := transferParams(t)
+		params["priority"] = signals.Priority
+		recordAudit(ctx, auditLog, audit.Entry{Action: "transfer.submit", Remote: t.SrcRemote, Path: t.SrcPath, Params: params}, err)
+		if err != nil {
+			return sse.PatchHTMLByID("transfer-status", `<div id="transfer-status" class="error">`+err.Error()+`</div>`)
+		}
+		return sse.PatchTempl(status)
 	})
 
 	// Jobs API
 	r.GET("/api/jobs/refresh", func(ctx *router.Context) error {
+		group := readGroupSignal(ctx)
 		sse := ctx.SSE()
-		jobs, err := getJobsInfo(rc)
+		jobs, err := getJobsInfo(rc, group)
 		if err != nil {
 			return sse.PatchHTMLByID("jobs-list", `<div class="error">`+err.Error()+`</div>`)
 		}
@@ -276,17 +480,52 @@ func cmdServe() {
 	})
 
 	r.POST("/api/jobs/{id}/stop", func(ctx *router.Context) error {
+		group := readGroupSignal(ctx)
 		sse := ctx.SSE()
 		id := ctx.Param("id")
 		var jobID int64
 		fmt.Sscanf(id, "%d", &jobID)
-		if err := rc.StopJob(jobID); err != nil {
+		err := rc.StopJob(jobID)
+		recordAudit(ctx, auditLog, audit.Entry{Action: "job.stop", Params: map[string]any{"jobId": jobID}}, err)
+		if err != nil {
 			return sse.PatchHTMLByID(fmt.Sprintf("job-%d", jobID), `<div class="error">`+err.Error()+`</div>`)
 		}
-		jobs, _ := getJobsInfo(rc)
+		jobs, _ := getJobsInfo(rc, group)
+		return sse.PatchTemplByID("jobs-list", templates.JobsList(jobs))
+	})
+
+	// API: Stop every running job in a group (job/stopgroup)
+	r.POST("/api/jobs/stopgroup", func(ctx *router.Context) error {
+		filter := readGroupSignal(ctx)
+		sse := ctx.SSE()
+		err := rc.StopGroup(ctx.Query("group"))
+		recordAudit(ctx, auditLog, audit.Entry{Action: "job.stopgroup", Params: map[string]any{"group": ctx.Query("group")}}, err)
+		if err != nil {
+			return sse.PatchHTMLByID("jobs-list", `<div class="error">`+err.Error()+`</div>`)
+		}
+		jobs, _ := getJobsInfo(rc, filter)
 		return sse.PatchTemplByID("jobs-list", templates.JobsList(jobs))
 	})
 
+	registerHistoryRoutes(r, tracker)
+	registerTaskRoutes(r, sched, auditLog)
+	registerProfileRoutes(r, q, profileStore, auditLog)
+	registerQueueRoutes(r, q, auditLog)
+	registerNotificationRoutes(r, notifier, auditLog)
+	registerChartRoutes(r, sampler)
+	registerAuditRoutes(r, auditLog)
+	registerFileRoutes(r, rc, trashBin, auditLog, userPrefs, listings)
+	registerListingRoutes(r, listings, userPrefs)
+	registerSearchRoutes(r, rc, trashBin, newRunStops())
+	registerUsageRoutes(r, rc, trashBin, &usage.Cache{Max: usageCached})
+	registerDupesRoutes(r, rc, trashBin, auditLog, newDupeScans())
+	registerBatchRoutes(r, rc, q, trashBin, auditLog, userPrefs, listings, newRunStops())
+	registerTreeRoutes(r, rc)
+	registerPreviewRoutes(r, rc, thumbs)
+	registerEditorRoutes(r, rc, auditLog, userPrefs, listings)
+	registerUploadRoutes(r, rc, int64(maxUploadMB)<<20, auditLog, userPrefs, listings)
+	registerTrashRoutes(r, rc, trashBin, auditLog, userPrefs, listings)
+
 	// Stats API
 	r.GET("/api/stats/refresh", func(ctx *router.Context) error {
 		sse := ctx.SSE()
@@ -336,14 +575,27 @@ func formatSize(bytes int64) string {
 	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
 }
 
-func getJobsInfo(rc *rclone.Client) ([]templates.JobInfo, error) {
+// readGroupSignal returns the Jobs page group filter sent with a Datastar request.
+func readGroupSignal(ctx *router.Context) string {
+	var signals struct {
+		Group string `json:"group"`
+	}
+	ctx.ReadSignals(&signals)
+	return strings.TrimSpace(signals.Group)
+}
+
+// getJobsInfo lists jobs, keeping only those whose group contains group.
+func getJobsInfo(rc *rclone.Client, group string) ([]templates.JobInfo, error) {
 	jobs, err := rc.ListJobs()
 	if err != nil {
 		return nil, err
 	}
 
-	result := make([]templates.JobInfo, len(jobs))
-	for i, job := range jobs {
+	result := make([]templates.JobInfo, 0, len(jobs))
+	for _, job := range jobs {
+		if group != "" && !strings.Contains(job.Group, group) {
+			continue
+		}
 		status := "running"
 		if job.Finished {
 			if job.Success {
@@ -352,13 +604,13 @@ func getJobsInfo(rc *rclone.Client) ([]templates.JobInfo, error) {
 				status = "error"
 			}
 		}
-		result[i] = templates.JobInfo{
+		result = append(result, templates.JobInfo{
 			ID:        job.ID,
 			Group:     job.Group,
 			StartTime: job.StartTime,
 			Status:    status,
 			Error:     job.Error,
-		}
+		})
 	}
 	return result, nil
 }
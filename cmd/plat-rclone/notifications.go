@@ -0,0 +1,179 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/joeblew999/plat-rclone/pkg/audit"
+	"github.com/joeblew999/plat-rclone/pkg/datastar"
+	"github.com/joeblew999/plat-rclone/pkg/notify"
+	"github.com/joeblew999/plat-rclone/pkg/router"
+	"github.com/joeblew999/plat-rclone/templates"
+)
+
+// channelSignals is the Datastar form state of the notification channel form.
+type channelSignals struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	On       string `json:"on"`
+	Group    string `json:"group"`
+	URL      string `json:"url"`
+	SMTPAddr string `json:"smtpAddr"`
+	SMTPUser string `json:"smtpUser"`
+	SMTPPass string `json:"smtpPass"` // left empty to keep the stored password
+	From     string `json:"from"`
+	To       string `json:"to"` // comma or newline separated
+	Template string `json:"template"`
+}
+
+// channel converts the form state into a notify.Channel.
+func (f channelSignals) channel() notify.Channel {
+	c := notify.Channel{
+		Name:     strings.TrimSpace(f.Name),
+		Type:     f.Type,
+		On:       f.On,
+		Group:    strings.TrimSpace(f.Group),
+		Template: strings.TrimSpace(f.Template),
+	}
+	if f.Type == "email" {
+		c.SMTP = &notify.SMTP{
+			Addr:     strings.TrimSpace(f.SMTPAddr),
+			Username: strings.TrimSpace(f.SMTPUser),
+			Password: f.SMTPPass,
+			From:     strings.TrimSpace(f.From),
+			To:       splitLines(strings.ReplaceAll(f.To, ",", "\n")),
+		}
+	} else {
+		c.URL = strings.TrimSpace(f.URL)
+	}
+	return c
+}
+
+// channelToSignals is the inverse of channel, used to prefill the form.
+// The password is never sent back to the browser.
+func channelToSignals(c notify.Channel) channelSignals {
+	f := channelSignals{
+		Name:     c.Name,
+		Type:     c.Type,
+		On:       c.On,
+		Group:    c.Group,
+		URL:      c.URL,
+		Template: c.Template,
+	}
+	if f.On == "" {
+		f.On = "error"
+	}
+	if s := c.SMTP; s != nil {
+		f.SMTPAddr = s.Addr
+		f.SMTPUser = s.Username
+		f.From = s.From
+		f.To = strings.Join(s.To, ", ")
+	}
+	return f
+}
+
+func registerNotificationRoutes(r *router.Router, notifier *notify.Notifier, auditLog *audit.Log) {
+	store := notifier.Store()
+
+	r.Page("/notifications", func(ctx *router.Context) (string, error) {
+		return datastar.RenderTempl(templates.NotificationsPage(getChannelsInfo(notifier), notify.DefaultTemplate))
+	})
+
+	// API: Create or update a channel
+	r.POST("/api/notifications", func(ctx *router.Context) error {
+		var signals struct {
+			Channel channelSignals `json:"channel"`
+		}
+		err := ctx.ReadSignals(&signals)
+		sse := ctx.SSE()
+		if err != nil {
+			return sse.PatchHTMLByID("notify-status", `<div id="notify-status" class="error">`+err.Error()+`</div>`)
+		}
+
+		c := signals.Channel.channel()
+		if c.SMTP != nil && c.SMTP.Password == "" {
+			if old, err := store.Get(c.Name); err == nil && old.SMTP != nil {
+				c.SMTP.Password = old.SMTP.Password
+			}
+		}
+		err = store.Put(c)
+		params := map[string]any{"name": c.Name, "type": c.Type, "on": c.On, "group": c.Group}
+		if c.SMTP != nil {
+			params["smtp"] = c.SMTP.Addr
+			params["to"] = c.SMTP.To
+		} else {
+			params["url"] = c.URL
+		}
+		recordAudit(ctx, auditLog, audit.Entry{Action: "notification.save", Params: params}, err)
+		if err != nil {
+			return sse.PatchHTMLByID("notify-status", `<div id="notify-status" class="error">`+err.Error()+`</div>`)
+		}
+		sse.PatchHTMLByID("notify-status", `<div id="notify-status" class="notice">Saved channel `+c.Name+`</div>`)
+		return sse.PatchTempl(templates.ChannelsList(getChannelsInfo(notifier)))
+	})
+
+	// API: Send a sample failed-job notification
+	r.POST("/api/notifications/{name}/test", func(ctx *router.Context) error {
+		sse := ctx.SSE()
+		c, err := store.Get(ctx.Param("name"))
+		if err != nil {
+			return sse.PatchHTMLByID("notify-status", `<div id="notify-status" class="error">`+err.Error()+`</div>`)
+		}
+		err = notifier.Send(c, notify.SampleEvent())
+		recordAudit(ctx, auditLog, audit.Entry{Action: "notification.test", Params: map[string]any{"name": c.Name}}, err)
+		if err != nil {
+			sse.PatchHTMLByID("notify-status", `<div id="notify-status" class="error">Test failed: `+err.Error()+`</div>`)
+		} else {
+			sse.PatchHTMLByID("notify-status", `<div id="notify-status" class="notice">Test notification sent to `+c.Name+`</div>`)
+		}
+		return sse.PatchTempl(templates.ChannelsList(getChannelsInfo(notifier)))
+	})
+
+	// API: Load a channel into the form
+	r.POST("/api/notifications/{name}/edit", func(ctx *router.Context) error {
+		sse := ctx.SSE()
+		c, err := store.Get(ctx.Param("name"))
+		if err != nil {
+			return sse.PatchHTMLByID("notify-status", `<div id="notify-status" class="error">`+err.Error()+`</div>`)
+		}
+		return sse.PatchSignals(map[string]any{"channel": channelToSignals(c)})
+	})
+
+	r.DELETE("/api/notifications/{name}", func(ctx *router.Context) error {
+		sse := ctx.SSE()
+		name := ctx.Param("name")
+		err := store.Delete(name)
+		recordAudit(ctx, auditLog, audit.Entry{Action: "notification.delete", Params: map[string]any{"name": name}}, err)
+		if err != nil {
+			return sse.PatchHTMLByID("notify-status", `<div id="notify-status" class="error">`+err.Error()+`</div>`)
+		}
+		return sse.RemoveByID("channel-" + name)
+	})
+}
+
+func getChannelsInfo(notifier *notify.Notifier) []templates.ChannelInfo {
+	list := notifier.Store().List()
+	result := make([]templates.ChannelInfo, len(list))
+	for i, c := range list {
+		info := templates.ChannelInfo{
+			Name:  c.Name,
+			Type:  c.Type,
+			On:    c.On,
+			Group: c.Group,
+		}
+		if info.On == "" {
+			info.On = "error"
+		}
+		switch {
+		case c.SMTP != nil:
+			info.Target = strings.Join(c.SMTP.To, ", ") + " via " + c.SMTP.Addr
+		default:
+			info.Target = c.URL
+		}
+		if d, ok := notifier.Last(c.Name); ok {
+			info.LastSent = d.Time.Local().Format("2006-01-02 15:04:05")
+			info.LastError = d.Error
+		}
+		result[i] = info
+	}
+	return result
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/a-h/templ"
+
+	"github.com/joeblew999/plat-rclone/pkg/preview"
+	"github.com/joeblew999/plat-rclone/pkg/rclone"
+	"github.com/joeblew999/plat-rclone/pkg/router"
+	"github.com/joeblew999/plat-rclone/pkg/rpath"
+	"github.com/joeblew999/plat-rclone/pkg/thumb"
+	"github.com/joeblew999/plat-rclone/templates"
+)
+
+func registerPreviewRoutes(r *router.Router, rc *rclone.Client, thumbs *thumb.Cache) {
+	// API: Show a file in the preview panel. Only the first
+	// preview.TextLimit bytes are read, however big the file is.
+	r.GET("/api/preview/{remote}", func(ctx *router.Context) error {
+		sse := ctx.SSE()
+		remote := ctx.Param("remote")
+		file := rpath.Clean(ctx.Query("path"))
+		return sse.PatchTempl(templates.PreviewPanel(getPreviewInfo(ctx.Request, rc, remote, file)))
+	})
+
+	// A JPEG thumbnail of an image, at most size pixels on its longest
+	// side. Thumbnails are made once per version of the image and then
+	// served from the disk cache.
+	r.Download("/thumb/{remote}", func(w http.ResponseWriter, req *http.Request) {
+		remote := router.NewContext(w, req).Param("remote")
+		file := rpath.Clean(req.URL.Query().Get("path"))
+		size, _ := strconv.Atoi(req.URL.Query().Get("size"))
+		size = thumb.ClampSize(size)
+
+		if !thumb.Supported(file) {
+			http.Error(w, "no thumbnails for this file type", http.StatusUnsupportedMediaType)
+			return
+		}
+		item, err := rc.Stat(remote, file)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if item == nil || item.IsDir {
+			http.NotFound(w, req)
+			return
+		}
+		key := thumb.Key(remote, file, item.ModTime, item.Size, size)
+		w.Header().Set("ETag", `"`+key+`"`)
+		w.Header().Set("Cache-Control", "private, max-age=300")
+		if req.Header.Get("If-None-Match") == `"`+key+`"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		data, ok := thumbs.Get(key)
+		if !ok {
+			if data, err = makeThumb(req.Context(), rc, remote, file, item.Size, size); err != nil {
+				w.Header().Del("ETag")
+				w.Header().Del("Cache-Control")
+				http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+				return
+			}
+			if err := thumbs.Put(key, data); err != nil {
+				log.Printf("thumb cache: %v", err)
+			}
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(data)
+	})
+}
+
+// makeThumb reads an image from the remote and returns its thumbnail.
+func makeThumb(ctx context.Context, rc *rclone.Client, remote, file string, fileSize int64, size int) ([]byte, error) {
+	if fileSize > thumb.MaxSource {
+		return nil, fmt.Errorf("image is too large to thumbnail")
+	}
+	data, truncated, err := rc.ReadPrefix(ctx, remote, file, thumb.MaxSource)
+	if err != nil {
+		return nil, err
+	}
+	if truncated {
+		return nil, fmt.Errorf("image is too large to thumbnail")
+	}
+	var buf bytes.Buffer
+	if err := thumb.Make(&buf, bytes.NewReader(data), size); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func getPreviewInfo(req *http.Request, rc *rclone.Client, remote, file string) templates.PreviewInfo {
+	kind := preview.Detect(file)
+	info := templates.PreviewInfo{
+		Name:        rpath.Base(file),
+		Kind:        string(kind),
+		DownloadURL: rpath.URL("/download/{remote}", remote, file),
+	}
+	info.InlineURL = info.DownloadURL + "&inline=1"
+
+	item, err := rc.Stat(remote, file)
+	switch {
+	case err != nil:
+		info.Error = err.Error()
+		return info
+	case item == nil:
+		info.Error = fmt.Sprintf("%s:%s not found", remote, file)
+		return info
+	case item.IsDir:
+		info.Error = "folders have no preview"
+		return info
+	}
+	info.Size = formatSize(item.Size)
+	info.ModTime = item.ModTime
+
+	if kind.IsMedia() {
+		if kind == preview.Image && thumb.Supported(file) && item.Size <= thumb.MaxSource {
+			info.ThumbURL = rpath.URL("/thumb/{remote}", remote, file) + "&v=" + url.QueryEscape(item.ModTime)
+		}
+		return info
+	}
+
+	data, truncated, err := rc.ReadPrefix(req.Context(), remote, file, preview.TextLimit)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	body, err := preview.Render(file, kind, data, truncated)
+	if err != nil {
+		if !errors.Is(err, preview.ErrBinary) {
+			info.Error = err.Error()
+		}
+		info.Kind = ""
+		return info
+	}
+	info.Body = templ.Raw(body)
+	if truncated {
+		info.Truncated = "Showing the first " + formatSize(preview.TextLimit) + " of " + info.Size
+	}
+	return info
+}
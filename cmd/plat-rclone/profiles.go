@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/joeblew999/plat-rclone/pkg/audit"
+	"github.com/joeblew999/plat-rclone/pkg/datastar"
+	"github.com/joeblew999/plat-rclone/pkg/profiles"
+	"github.com/joeblew999/plat-rclone/pkg/queue"
+	"github.com/joeblew999/plat-rclone/pkg/router"
+	"github.com/joeblew999/plat-rclone/templates"
+)
+
+// maxImportSize caps the size of an imported profiles document.
+const maxImportSize = 1 << 20
+
+func registerProfileRoutes(r *router.Router, q *queue.Queue, store *profiles.Store, auditLog *audit.Log) {
+	r.Page("/profiles", func(ctx *router.Context) (string, error) {
+		return datastar.RenderTempl(templates.ProfilesPage(getProfilesInfo(store)))
+	})
+
+	// Export: the whole store as a YAML download
+	r.Mux.Get("/profiles/export.yaml", func(w http.ResponseWriter, req *http.Request) {
+		data, err := store.Export()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Header().Set("Content-Disposition", `attachment; filename="plat-rclone-profiles.yaml"`)
+		w.Write(data)
+	})
+
+	// API: Save the current copy/sync dialog as a profile
+	r.POST("/api/profiles", func(ctx *router.Context) error {
+		var signals struct {
+			Transfer    transferSignals `json:"transfer"`
+			ProfileName string          `json:"profileName"`
+		}
+		err := ctx.ReadSignals(&signals)
+		sse := ctx.SSE()
+		if err != nil {
+			return sse.PatchHTMLByID("profile-status", `<div id="profile-status" class="error">`+err.Error()+`</div>`)
+		}
+
+		t, err := signals.Transfer.transfer()
+		if err != nil {
+			return sse.PatchHTMLByID("profile-status", `<div id="profile-status" class="error">`+err.Error()+`</div>`)
+		}
+		name := strings.TrimSpace(signals.ProfileName)
+		err = store.Put(profiles.FromTransfer(name, t))
+		params := transferParams(t)
+		params["name"] = name
+		recordAudit(ctx, auditLog, audit.Entry{Action: "profile.save", Params: params}, err)
+		if err != nil {
+			return sse.PatchHTMLByID("profile-status", `<div id="profile-status" class="error">`+err.Error()+`</div>`)
+		}
+		return sse.PatchHTMLByID("profile-status", `<div id="profile-status" class="notice">Saved profile <a href="/profiles">`+name+`</a></div>`)
+	})
+
+	// API: Import a YAML document (uploaded file or pasted text)
+	r.POST("/api/profiles/import", func(ctx *router.Context) error {
+		data, err := readImport(ctx.Request)
+		replace := ctx.FormValue("replace") == "true"
+		sse := ctx.SSE()
+		if err != nil {
+			return sse.PatchHTMLByID("profile-status", `<div id="profile-status" class="error">`+err.Error()+`</div>`)
+		}
+
+		n, err := store.Import(data, replace)
+		recordAudit(ctx, auditLog, audit.Entry{Action: "profile.import", Params: map[string]any{"replace": replace, "imported": n}}, err)
+		if err != nil {
+			return sse.PatchHTMLByID("profile-status", `<div id="profile-status" class="error">`+err.Error()+`</div>`)
+		}
+		sse.PatchHTMLByID("profile-status", fmt.Sprintf(`<div id="profile-status" class="notice">Imported %d profiles</div>`, n))
+		return sse.PatchTempl(templates.ProfilesList(getProfilesInfo(store)))
+	})
+
+	// API: Run a profile with one click
+	r.POST("/api/profiles/{name}/run", func(ctx *router.Context) error {
+		sse := ctx.SSE()
+		p, err := store.Get(ctx.Param("name"))
+		if err != nil {
+			return sse.PatchHTMLByID("profile-status", `<div id="profile-status" class="error">`+err.Error()+`</div>`)
+		}
+		t, err := p.Transfer()
+		if err != nil {
+			return sse.PatchHTMLByID("profile-status", `<div id="profile-status" class="error">`+err.Error()+`</div>`)
+		}
+		status, err := submitTransfer(q, t, queue.Normal, "profile:"+p.Name, "profile-status")
+		params := transferParams(t)
+		params["profile"] = p.Name
+		recordAudit(ctx, auditLog, audit.Entry{Action: "profile.run", Remote: t.SrcRemote, Path: t.SrcPath, Params: params}, err)
+		if err != nil {
+			return sse.PatchHTMLByID("profile-status", `<div id="profile-status" class="error">`+err.Error()+`</div>`)
+		}
+		return sse.PatchTempl(status)
+	})
+
+	r.DELETE("/api/profiles/{name}", func(ctx *router.Context) error {
+		sse := ctx.SSE()
+		name := ctx.Param("name")
+		err := store.Delete(name)
+		recordAudit(ctx, auditLog, audit.Entry{Action: "profile.delete", Params: map[string]any{"name": name}}, err)
+		if err != nil {
+			return sse.PatchHTMLByID("profile-status", `<div id="profile-status" class="error">`+err.Error()+`</div>`)
+		}
+		return sse.RemoveByID("profile-" + name)
+	})
+}
+
+// readImport returns the uploaded profiles file, or the pasted YAML if no
+// file was chosen.
+func readImport(req *http.Request) ([]byte, error) {
+	if err := req.ParseMultipartForm(maxImportSize); err != nil && err != http.ErrNotMultipart {
+		return nil, fmt.Errorf("read import: %w", err)
+	}
+	if file, _, err := req.FormFile("file"); err == nil {
+		defer file.Close()
+		data, err := io.ReadAll(io.LimitReader(file, maxImportSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("read import: %w", err)
+		}
+		if len(data) > maxImportSize {
+			return nil, fmt.Errorf("the file is larger than %s", formatSize(maxImportSize))
+		}
+		if len(data) > 0 {
+			return data, nil
+		}
+	}
+	if text := strings.TrimSpace(req.FormValue("yaml")); text != "" {
+		return []byte(text), nil
+	}
+	return nil, fmt.Errorf("choose a YAML file or paste a profiles document")
+}
+
+func getProfilesInfo(store *profiles.Store) []templates.ProfileInfo {
+	list := store.List()
+	result := make([]templates.ProfileInfo, 0, len(list))
+	for _, p := range list {
+		t, err := p.Transfer()
+		if err != nil {
+			continue
+		}
+		var filters []string
+		for _, rule := range stringList(t.Filter["IncludeRule"]) {
+			filters = append(filters, "+ "+rule)
+		}
+		for _, rule := range stringList(t.Filter["ExcludeRule"]) {
+			filters = append(filters, "- "+rule)
+		}
+		result = append(result, templates.ProfileInfo{
+			Name:      p.Name,
+			Operation: describeTransfer(t),
+			Group:     t.Group,
+			Filters:   strings.Join(filters, ", "),
+		})
+	}
+	return result
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/a-h/templ"
+
+	"github.com/joeblew999/plat-rclone/pkg/audit"
+	"github.com/joeblew999/plat-rclone/pkg/queue"
+	"github.com/joeblew999/plat-rclone/pkg/rclone"
+	"github.com/joeblew999/plat-rclone/pkg/router"
+	"github.com/joeblew999/plat-rclone/templates"
+)
+
+func registerQueueRoutes(r *router.Router, q *queue.Queue, auditLog *audit.Log) {
+	r.GET("/api/queue", func(ctx *router.Context) error {
+		sse := ctx.SSE()
+		return sse.PatchTempl(templates.QueueSection(getQueueInfo(q)))
+	})
+
+	// API: Reorder or cancel a queue item
+	r.POST("/api/queue/{id}/{action}", func(ctx *router.Context) error {
+		sse := ctx.SSE()
+		id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+		if err != nil {
+			return sse.PatchHTMLByID("job-queue", `<div id="job-queue" class="error">invalid queue item</div>`)
+		}
+		switch ctx.Param("action") {
+		case "up":
+			err = q.Move(id, -1)
+		case "down":
+			err = q.Move(id, 1)
+		case "cancel":
+			err = q.Cancel(id)
+		default:
+			err = fmt.Errorf("unknown queue action %q", ctx.Param("action"))
+		}
+		recordAudit(ctx, auditLog, audit.Entry{Action: "queue." + ctx.Param("action"), Params: map[string]any{"item": id}}, err)
+		if err != nil {
+			return sse.PatchHTMLByID("job-queue", `<div id="job-queue" class="error">`+err.Error()+`</div>`)
+		}
+		return sse.PatchTempl(templates.QueueSection(getQueueInfo(q)))
+	})
+}
+
+// submitTransfer queues a transfer and renders the outcome into the
+// status element id: started, waiting for a slot, or failed to launch.
+func submitTransfer(q *queue.Queue, t rclone.Transfer, priority int, source, id string) (templ.Component, error) {
+	it := q.Submit(t, priority, source)
+	switch it.Status {
+	case "queued":
+		queued, _, _ := q.Snapshot()
+		pos := 0
+		for i, other := range queued {
+			if other.ID == it.ID {
+				pos = i + 1
+			}
+		}
+		return templates.TransferQueued(id, it.ID, pos), nil
+	case "error":
+		return nil, fmt.Errorf("%s", it.Error)
+	}
+	return templates.TransferStarted(id, it.JobID, t.Group), nil
+}
+
+// parsePriority maps the dialog's priority choice to a queue priority.
+func parsePriority(s string) int {
+	switch s {
+	case "high":
+		return queue.High
+	case "low":
+		return queue.Low
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		return n
+	}
+	return queue.Normal
+}
+
+func priorityLabel(p int) string {
+	switch p {
+	case queue.High:
+		return "high"
+	case queue.Normal:
+		return "normal"
+	case queue.Low:
+		return "low"
+	}
+	return strconv.Itoa(p)
+}
+
+func getQueueInfo(q *queue.Queue) templates.QueueInfo {
+	queued, running, done := q.Snapshot()
+	info := templates.QueueInfo{Limits: describeLimits(q)}
+	for _, it := range queued {
+		info.Queued = append(info.Queued, queueItemInfo(it, it.Enqueued.Format("15:04:05")))
+	}
+	for _, it := range running {
+		info.Running = append(info.Running, queueItemInfo(it, it.Started.Format("15:04:05")))
+	}
+	for _, it := range done {
+		info.Done = append(info.Done, queueItemInfo(it, it.Finished.Format("15:04:05")))
+	}
+	return info
+}
+
+func queueItemInfo(it queue.Item, at string) templates.QueueItemInfo {
+	return templates.QueueItemInfo{
+		ID:        it.ID,
+		Operation: describeTransfer(it.Transfer),
+		Group:     it.Transfer.Group,
+		Priority:  priorityLabel(it.Priority),
+		Source:    it.Source,
+		Status:    it.Status,
+		Time:      at,
+		JobID:     it.JobID,
+		Error:     it.Error,
+	}
+}
+
+func describeLimits(q *queue.Queue) string {
+	limit := func(n int) string {
+		if n <= 0 {
+			return "unlimited"
+		}
+		return strconv.Itoa(n)
+	}
+	return fmt.Sprintf("max %s running, %s per remote", limit(q.MaxRunning), limit(q.MaxPerRemote))
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joeblew999/plat-rclone/pkg/datastar"
+	"github.com/joeblew999/plat-rclone/pkg/rclone"
+	"github.com/joeblew999/plat-rclone/pkg/router"
+	"github.com/joeblew999/plat-rclone/pkg/rpath"
+	"github.com/joeblew999/plat-rclone/pkg/trash"
+	"github.com/joeblew999/plat-rclone/templates"
+)
+
+const (
+	// searchLimit caps the matches one search returns.
+	searchLimit = 5000
+	// searchParallel is how many remotes are searched at once.
+	searchParallel = 4
+	// searchFlush is how often found matches are sent to the page.
+	searchFlush = 250 * time.Millisecond
+)
+
+// searchSignals is the search form.
+type searchSignals struct {
+	Search struct {
+		Pattern   string `json:"pattern"`
+		Regex     bool   `json:"regex"`
+		MatchCase bool   `json:"matchCase"`
+		Remote    string `json:"remote"` // "" for every remote
+		Path      string `json:"path"`
+		MinSize   string `json:"minSize"`
+		MaxSize   string `json:"maxSize"`
+		MaxAge    string `json:"maxAge"`
+		MinAge    string `json:"minAge"`
+	} `json:"search"`
+}
+
+// filter turns the form into rclone filter options, so the remotes only
+// send back what matches.
+func (s searchSignals) filter() (map[string]any, error) {
+	f := s.Search
+	pattern := strings.TrimSpace(f.Pattern)
+	if pattern == "" {
+		return nil, fmt.Errorf("enter a name or pattern to search for")
+	}
+	rule := pattern
+	if f.Regex {
+		re, err := nameRegexp(pattern)
+		if err != nil {
+			return nil, err
+		}
+		rule = "{{" + re + "}}"
+	} else if strings.Contains(pattern, "/") {
+		return nil, fmt.Errorf("patterns match names, so they cannot contain /")
+	}
+	filter := map[string]any{
+		"IncludeRule": []string{rule},
+		"IgnoreCase":  !f.MatchCase,
+	}
+	limits := []struct{ key, value, kind string }{
+		{"MinSize", f.MinSize, "size"},
+		{"MaxSize", f.MaxSize, "size"},
+		{"MaxAge", f.MaxAge, "age"},
+		{"MinAge", f.MinAge, "age"},
+	}
+	for _, l := range limits {
+		value := strings.TrimSpace(l.value)
+		if value == "" {
+			continue
+		}
+		if rclone.CheckFilter(map[string]any{l.key: value}) != nil {
+			return nil, fmt.Errorf("%q is not a valid %s", value, l.kind)
+		}
+		filter[l.key] = value
+	}
+	if err := rclone.CheckFilter(filter); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// nameRegexp makes re match anywhere in a file's name, unless it is
+// anchored with ^ or $. rclone matches the result against whole names.
+func nameRegexp(re string) (string, error) {
+	if _, err := regexp.Compile(re); err != nil {
+		return "", fmt.Errorf("bad regular expression: %w", err)
+	}
+	if strings.Contains(re, "}}") {
+		return "", fmt.Errorf("regular expressions cannot contain }}")
+	}
+	prefix, suffix := "[^/]*", "[^/]*"
+	if rest, ok := strings.CutPrefix(re, "^"); ok {
+		re, prefix = rest, ""
+	}
+	if rest, ok := strings.CutSuffix(re, "$"); ok && !strings.HasSuffix(rest, `\`) {
+		re, suffix = rest, ""
+	}
+	return prefix + "(?:" + re + ")" + suffix, nil
+}
+
+// runStops holds a way to stop each running search or batch, by ID, for
+// its Stop button.
+type runStops struct {
+	mu   sync.Mutex
+	stop map[string]context.CancelFunc
+}
+
+func newRunStops() *runStops {
+	return &runStops{stop: map[string]context.CancelFunc{}}
+}
+
+// add files cancel under a new ID. remove drops it once the run is over.
+func (s *runStops) add(cancel context.CancelFunc) (id string, remove func()) {
+	b := make([]byte, 8)
+	rand.Read(b)
+	id = hex.EncodeToString(b)
+	s.mu.Lock()
+	s.stop[id] = cancel
+	s.mu.Unlock()
+	return id, func() {
+		s.mu.Lock()
+		delete(s.stop, id)
+		s.mu.Unlock()
+	}
+}
+
+// cancel stops the run with id, if it is still going.
+func (s *runStops) cancel(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stop, ok := s.stop[id]; ok {
+		stop()
+	}
+}
+
+func registerSearchRoutes(r *router.Router, rc *rclone.Client, trashBin *trash.Trash, searches *runStops) {
+	// The search page; remote and path start it in one folder
+	r.Page("/search", func(ctx *router.Context) (string, error) {
+		remotes, err := getRemotesInfo(rc)
+		if err != nil {
+			remotes = []templates.RemoteInfo{}
+		}
+		return datastar.RenderTempl(templates.SearchPage(remotes, ctx.Query("remote"), rpath.Clean(ctx.Query("path"))))
+	})
+
+	// API: Search one or every remote, streaming matches as they are found
+	r.GET("/api/search", func(ctx *router.Context) error {
+		var signals searchSignals
+		ctx.ReadSignals(&signals)
+		sse := ctx.SSE()
+
+		filter, err := signals.filter()
+		if err != nil {
+			return sse.PatchTempl(templates.SearchStatus(templates.SearchState{Errors: []string{err.Error()}}))
+		}
+		remotes := []string{signals.Search.Remote}
+		if signals.Search.Remote == "" {
+			if remotes, err = rc.ListRemotes(); err != nil {
+				return sse.PatchTempl(templates.SearchStatus(templates.SearchState{Errors: []string{err.Error()}}))
+			}
+		}
+		return runSearch(ctx, sse, rc, trashBin, searches, remotes, rpath.Clean(signals.Search.Path), filter)
+	})
+
+	// API: Stop a running search, keeping what it found
+	r.POST("/api/search/{id}/stop", func(ctx *router.Context) error {
+		ctx.SSE()
+		searches.cancel(ctx.Param("id"))
+		return nil
+	})
+}
+
+// runSearch lists dir recursively on each remote, a few at a time, and
+// appends the files filter lets through to the results table. The trash
+// is left out.
+func runSearch(ctx *router.Context, sse *datastar.SSE, rc *rclone.Client, trashBin *trash.Trash, searches *runStops, remotes []string, dir string, filter map[string]any) error {
+	searchCtx, cancel := context.WithCancel(ctx.Request.Context())
+	defer cancel()
+	id, remove := searches.add(cancel)
+	defer remove()
+
+	state := templates.SearchState{ID: id, Running: true, Remotes: len(remotes)}
+	sse.PatchTempl(templates.SearchRows(nil))
+	sse.PatchTempl(templates.SearchStatus(state))
+
+	type result struct {
+		match  *templates.SearchMatch
+		remote string // set when the remote is done
+		err    error
+	}
+	results := make(chan result)
+	sem := make(chan struct{}, searchParallel)
+	for _, remote := range remotes {
+		go func() {
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-searchCtx.Done():
+				results <- result{remote: remote}
+				return
+			}
+			opt := map[string]any{"recurse": true, "filesOnly": true}
+			err := rc.ListStream(searchCtx, remote, dir, opt, excludeTrash(trashBin, remote, dir, filter), func(item rclone.ListItem) error {
+				match := &templates.SearchMatch{
+					Remote:  remote,
+					Path:    rpath.Join(dir, item.Path),
+					Size:    formatSize(item.Size),
+					ModTime: item.ModTime,
+				}
+				select {
+				case results <- result{match: match}:
+					return nil
+				case <-searchCtx.Done():
+					return searchCtx.Err()
+				}
+			})
+			results <- result{remote: remote, err: err}
+		}()
+	}
+
+	var batch []templates.SearchMatch
+	flush := func() {
+		if len(batch) > 0 {
+			sse.AppendTemplByID("search-rows", templates.SearchMatches(batch))
+			batch = nil
+		}
+		sse.PatchTempl(templates.SearchStatus(state))
+	}
+	tick := time.NewTicker(searchFlush)
+	defer tick.Stop()
+	for state.Finished < len(remotes) {
+		select {
+		case res := <-results:
+			switch {
+			case res.match != nil && state.Matches < searchLimit:
+				state.Matches++
+				batch = append(batch, *res.match)
+				if state.Matches == searchLimit {
+					state.Limited = true
+					cancel()
+				}
+			case res.remote != "":
+				state.Finished++
+				if res.err != nil && searchCtx.Err() == nil {
+					state.Errors = append(state.Errors, res.remote+": "+res.err.Error())
+				}
+			}
+		case <-tick.C:
+			flush()
+		}
+	}
+	state.Running = false
+	state.Stopped = !state.Limited && searchCtx.Err() != nil
+	flush()
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"time"
+
+	"github.com/joeblew999/plat-rclone/pkg/audit"
+	"github.com/joeblew999/plat-rclone/pkg/datastar"
+	"github.com/joeblew999/plat-rclone/pkg/router"
+	"github.com/joeblew999/plat-rclone/pkg/scheduler"
+	"github.com/joeblew999/plat-rclone/templates"
+)
+
+// taskRunsShown caps how many recent runs each task card lists.
+const taskRunsShown = 5
+
+// taskSignals is the Datastar form state of the task editor.
+type taskSignals struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+	Enabled  bool   `json:"enabled"`
+}
+
+func registerTaskRoutes(r *router.Router, sched *scheduler.Scheduler, auditLog *audit.Log) {
+	r.Page("/tasks", func(ctx *router.Context) (string, error) {
+		tasks, _ := getTasksInfo(sched)
+		return datastar.RenderTempl(templates.TasksPage(tasks))
+	})
+
+	// API: Refresh tasks list
+	r.GET("/api/tasks/refresh", func(ctx *router.Context) error {
+		sse := ctx.SSE()
+		return patchTasks(sse, sched)
+	})
+
+	// API: Create or update a task
+	r.POST("/api/tasks", func(ctx *router.Context) error {
+		var signals struct {
+			Task     taskSignals     `json:"task"`
+			Transfer transferSignals `json:"transfer"`
+		}
+		err := ctx.ReadSignals(&signals)
+		sse := ctx.SSE()
+		if err != nil {
+			return sse.PatchHTMLByID("task-status", `<div id="task-status" class="error">`+err.Error()+`</div>`)
+		}
+
+		t, err := signals.Transfer.transfer()
+		if err != nil {
+			return sse.PatchHTMLByID("task-status", `<div id="task-status" class="error">`+err.Error()+`</div>`)
+		}
+		err = sched.Save(scheduler.Task{
+			Name:     signals.Task.Name,
+			Schedule: signals.Task.Schedule,
+			Enabled:  signals.Task.Enabled,
+			Transfer: t,
+		})
+		params := transferParams(t)
+		params["name"] = signals.Task.Name
+		params["schedule"] = signals.Task.Schedule
+		params["enabled"] = signals.Task.Enabled
+		recordAudit(ctx, auditLog, audit.Entry{Action: "task.save", Params: params}, err)
+		if err != nil {
+			return sse.PatchHTMLByID("task-status", `<div id="task-status" class="error">`+err.Error()+`</div>`)
+		}
+
+		sse.PatchHTMLByID("task-status", `<div id="task-status" class="notice">Task saved</div>`)
+		return patchTasks(sse, sched)
+	})
+
+	// API: Launch a task immediately
+	r.POST("/api/tasks/{name}/run", func(ctx *router.Context) error {
+		sse := ctx.SSE()
+		_, err := sched.RunNow(ctx.Param("name"))
+		recordAudit(ctx, auditLog, audit.Entry{Action: "task.run", Params: map[string]any{"name": ctx.Param("name")}}, err)
+		if err != nil {
+			return sse.PatchHTMLByID("task-status", `<div id="task-status" class="error">`+err.Error()+`</div>`)
+		}
+		return patchTasks(sse, sched)
+	})
+
+	r.POST("/api/tasks/{name}/enable", func(ctx *router.Context) error {
+		sse := ctx.SSE()
+		err := sched.SetEnabled(ctx.Param("name"), true)
+		recordAudit(ctx, auditLog, audit.Entry{Action: "task.enable", Params: map[string]any{"name": ctx.Param("name")}}, err)
+		if err != nil {
+			return sse.PatchHTMLByID("task-status", `<div id="task-status" class="error">`+err.Error()+`</div>`)
+		}
+		return patchTasks(sse, sched)
+	})
+
+	r.POST("/api/tasks/{name}/disable", func(ctx *router.Context) error {
+		sse := ctx.SSE()
+		err := sched.SetEnabled(ctx.Param("name"), false)
+		recordAudit(ctx, auditLog, audit.Entry{Action: "task.disable", Params: map[string]any{"name": ctx.Param("name")}}, err)
+		if err != nil {
+			return sse.PatchHTMLByID("task-status", `<div id="task-status" class="error">`+err.Error()+`</div>`)
+		}
+		return patchTasks(sse, sched)
+	})
+
+	// API: Load a task into the editor form
+	r.POST("/api/tasks/{name}/edit", func(ctx *router.Context) error {
+		sse := ctx.SSE()
+		t, err := sched.Get(ctx.Param("name"))
+		if err != nil {
+			return sse.PatchHTMLByID("task-status", `<div id="task-status" class="error">`+err.Error()+`</div>`)
+		}
+		return sse.PatchSignals(map[string]any{
+			"task": taskSignals{
+				Name:     t.Name,
+				Schedule: t.Schedule,
+				Enabled:  t.Enabled,
+			},
+			"transfer": transferToSignals(t.Transfer),
+		})
+	})
+
+	r.DELETE("/api/tasks/{name}", func(ctx *router.Context) error {
+		sse := ctx.SSE()
+		name := ctx.Param("name")
+		err := sched.Delete(name)
+		recordAudit(ctx, auditLog, audit.Entry{Action: "task.delete", Params: map[string]any{"name": name}}, err)
+		if err != nil {
+			return sse.PatchHTMLByID("task-status", `<div id="task-status" class="error">`+err.Error()+`</div>`)
+		}
+		return sse.RemoveByID("task-" + name)
+	})
+}
+
+func patchTasks(sse *datastar.SSE, sched *scheduler.Scheduler) error {
+	tasks, err := getTasksInfo(sched)
+	if err != nil {
+		return sse.PatchHTMLByID("tasks-list", `<div id="tasks-list" class="error">`+err.Error()+`</div>`)
+	}
+	return sse.PatchTempl(templates.TasksList(tasks))
+}
+
+func getTasksInfo(sched *scheduler.Scheduler) ([]templates.TaskInfo, error) {
+	tasks, err := sched.Tasks()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]templates.TaskInfo, len(tasks))
+	for i, t := range tasks {
+		info := templates.TaskInfo{
+			Name:      t.Name,
+			Schedule:  t.Schedule,
+			Enabled:   t.Enabled,
+			Operation: describeTransfer(t.Transfer),
+			Group:     t.Group(),
+		}
+		if next := sched.Next(t.Name); !next.IsZero() {
+			info.Next = next.Format("2006-01-02 15:04")
+		}
+		for j, run := range t.Runs {
+			if j == taskRunsShown {
+				break
+			}
+			ri := templates.TaskRunInfo{
+				JobID:   run.JobID,
+				Started: run.Started.Format("2006-01-02 15:04:05"),
+				Status:  run.Status,
+				Error:   run.Error,
+				Manual:  run.Manual,
+			}
+			if !run.Finished.IsZero() {
+				ri.Duration = run.Finished.Sub(run.Started).Round(time.Second).String()
+			}
+			info.Runs = append(info.Runs, ri)
+		}
+		result[i] = info
+	}
+	return result, nil
+}
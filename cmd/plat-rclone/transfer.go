@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/joeblew999/plat-rclone/pkg/history"
+	"github.com/joeblew999/plat-rclone/pkg/rclone"
+)
+
+// recordStarted adds a launched job to the history, logging any failure.
+func recordStarted(tracker *history.Tracker, jobID int64, t rclone.Transfer) {
+	if err := tracker.Started(jobID, t); err != nil {
+		log.Printf("history: record job %d: %v", jobID, err)
+	}
+}
+
+// transferSignals is the Datastar form state of a copy/sync/move dialog.
+type transferSignals struct {
+	Op      string `json:"op"`
+	Src     string `json:"src"` // remote:path
+	Dst     string `json:"dst"` // remote:path
+	Group   string `json:"group"`
+	Include string `json:"include"` // filter rules, one per line
+	Exclude string `json:"exclude"`
+	DryRun  bool   `json:"dryRun"`
+}
+
+// transfer converts the form state into an rclone.Transfer.
+func (f transferSignals) transfer() (rclone.Transfer, error) {
+	srcRemote, srcPath, err := rclone.SplitFs(f.Src)
+	if err != nil {
+		return rclone.Transfer{}, fmt.Errorf("source: %w", err)
+	}
+	dstRemote, dstPath, err := rclone.SplitFs(f.Dst)
+	if err != nil {
+		return rclone.Transfer{}, fmt.Errorf("destination: %w", err)
+	}
+
+	t := rclone.Transfer{
+		Op:        f.Op,
+		SrcRemote: srcRemote,
+		SrcPath:   srcPath,
+		DstRemote: dstRemote,
+		DstPath:   dstPath,
+		Group:     strings.TrimSpace(f.Group),
+	}
+
+	t.Filter = filterRules(f.Include, f.Exclude)
+	if f.DryRun {
+		t.Config = map[string]any{"DryRun": true}
+	}
+	return t, nil
+}
+
+// filterRules builds an rclone _filter from include and exclude rules
+// given one per line. It returns nil when there are no rules.
+func filterRules(include, exclude string) map[string]any {
+	filter := map[string]any{}
+	if rules := splitLines(include); len(rules) > 0 {
+		filter["IncludeRule"] = rules
+	}
+	if rules := splitLines(exclude); len(rules) > 0 {
+		filter["ExcludeRule"] = rules
+	}
+	if len(filter) == 0 {
+		return nil
+	}
+	return filter
+}
+
+// transferToSignals is the inverse of transfer, used to prefill a dialog.
+func transferToSignals(t rclone.Transfer) transferSignals {
+	f := transferSignals{
+		Op:    t.Op,
+		Src:   t.SrcFs(),
+		Dst:   t.DstFs(),
+		Group: t.Group,
+	}
+	f.Include = strings.Join(stringList(t.Filter["IncludeRule"]), "\n")
+	f.Exclude = strings.Join(stringList(t.Filter["ExcludeRule"]), "\n")
+	if dry, ok := t.Config["DryRun"].(bool); ok {
+		f.DryRun = dry
+	}
+	return f
+}
+
+// describeTransfer renders a one-line summary such as "copy a:x → b:y".
+func describeTransfer(t rclone.Transfer) string {
+	s := fmt.Sprintf("%s %s → %s", t.Op, t.SrcFs(), t.DstFs())
+	if t.Config["DryRun"] == true {
+		s += " (dry run)"
+	}
+	return s
+}
+
+func splitLines(s string) []string {
+	var out []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			out = append(out, line)
+		}
+	}
+	return out
+}
+
+// stringList accepts []string or the []any produced by decoding JSON.
+func stringList(v any) []string {
+	switch v := v.(type) {
+	case []string:
+		return v
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, s := range v {
+			out = append(out, fmt.Sprint(s))
+		}
+		return out
+	}
+	return nil
+}
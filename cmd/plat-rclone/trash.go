@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/joeblew999/plat-rclone/pkg/audit"
+	"github.com/joeblew999/plat-rclone/pkg/datastar"
+	"github.com/joeblew999/plat-rclone/pkg/prefs"
+	"github.com/joeblew999/plat-rclone/pkg/rclone"
+	"github.com/joeblew999/plat-rclone/pkg/router"
+	"github.com/joeblew999/plat-rclone/pkg/rpath"
+	"github.com/joeblew999/plat-rclone/pkg/trash"
+	"github.com/joeblew999/plat-rclone/templates"
+)
+
+func registerTrashRoutes(r *router.Router, rc *rclone.Client, tr *trash.Trash, auditLog *audit.Log, userPrefs *prefs.Store, listings *listingRuns) {
+	r.Page("/trash", func(ctx *router.Context) (string, error) {
+		items, err := getTrashInfo(tr)
+		if err != nil {
+			return "", err
+		}
+		return datastar.RenderTempl(templates.TrashPage(items, describeRetention(tr)))
+	})
+
+	// API: Restore a trashed item. The browser's undo toast passes
+	// from=browser so the restored item reappears in the listing.
+	r.POST("/api/trash/{id}/restore", func(ctx *router.Context) error {
+		sse := ctx.SSE()
+		id := ctx.Param("id")
+
+		item, err := tr.Restore(id)
+		entry := audit.Entry{Action: "trash.restore", Params: map[string]any{"id": id}}
+		if item != nil {
+			entry.Remote, entry.Path = item.Remote, item.Path
+		}
+		recordAudit(ctx, auditLog, entry, err)
+		if ctx.Query("from") == "browser" {
+			if err != nil {
+				return sse.PatchTempl(templates.Toast("Undo failed: "+err.Error(), true))
+			}
+			if err := patchFileBrowser(ctx, sse, listings, userPrefs, item.Remote, rpath.Parent(item.Path)); err != nil {
+				return err
+			}
+			return sse.PatchTempl(templates.Toast("Restored "+item.Remote+":"+item.Path, false))
+		}
+		if err != nil {
+			return sse.PatchHTMLByID("trash-status", `<div id="trash-status" class="error">`+err.Error()+`</div>`)
+		}
+		sse.PatchHTMLByID("trash-status", `<div id="trash-status"></div>`)
+		return sse.RemoveByID("trash-" + id)
+	})
+
+	// API: Permanently delete a trashed item
+	r.POST("/api/trash/{id}/purge", func(ctx *router.Context) error {
+		sse := ctx.SSE()
+		id := ctx.Param("id")
+
+		item, err := tr.Purge(id)
+		entry := audit.Entry{Action: "trash.purge", Params: map[string]any{"id": id}}
+		if item != nil {
+			entry.Remote, entry.Path = item.Remote, item.Path
+		}
+		recordAudit(ctx, auditLog, entry, err)
+		if err != nil {
+			return sse.PatchHTMLByID("trash-status", `<div id="trash-status" class="error">`+err.Error()+`</div>`)
+		}
+		sse.PatchHTMLByID("trash-status", `<div id="trash-status"></div>`)
+		return sse.RemoveByID("trash-" + id)
+	})
+
+	// API: Permanently delete everything in the trash
+	r.POST("/api/trash/empty", func(ctx *router.Context) error {
+		sse := ctx.SSE()
+
+		n, err := tr.Empty("")
+		recordAudit(ctx, auditLog, audit.Entry{Action: "trash.empty", Params: map[string]any{"purged": n}}, err)
+		status := fmt.Sprintf(`<div id="trash-status" class="notice">Purged %d items.</div>`, n)
+		if err != nil {
+			status = `<div id="trash-status" class="error">` + err.Error() + `</div>`
+		}
+		sse.PatchHTMLByID("trash-status", status)
+		items, err := getTrashInfo(tr)
+		if err != nil {
+			return sse.PatchHTMLByID("trash-list", `<div id="trash-list" class="error">`+err.Error()+`</div>`)
+		}
+		return sse.PatchTempl(templates.TrashList(items))
+	})
+}
+
+func getTrashInfo(tr *trash.Trash) ([]templates.TrashItemInfo, error) {
+	list, err := tr.List("")
+	if err != nil {
+		return nil, err
+	}
+	items := make([]templates.TrashItemInfo, len(list))
+	for i, it := range list {
+		items[i] = templates.TrashItemInfo{
+			ID:      it.ID,
+			Remote:  it.Remote,
+			Path:    it.Path,
+			IsDir:   it.IsDir,
+			Size:    formatSize(it.Size),
+			Deleted: it.Deleted.Local().Format("2006-01-02 15:04"),
+		}
+		if exp := tr.Expires(it.Deleted); !exp.IsZero() {
+			items[i].Expires = exp.Local().Format("2006-01-02 15:04")
+		}
+	}
+	return items, nil
+}
+
+// describeRetention explains where deletes go and how long they stay.
+func describeRetention(tr *trash.Trash) string {
+	where := fmt.Sprintf("Deleted items are moved to %s/ on their remote", tr.Dir)
+	if tr.Dir == "" {
+		where = "Deletes are permanent unless a remote has its own trash folder"
+	}
+	for _, remote := range slices.Sorted(maps.Keys(tr.Dirs)) {
+		dir := tr.Dirs[remote]
+		if dir == "" {
+			where += fmt.Sprintf("; %s: deletes are permanent", remote)
+		} else {
+			where += fmt.Sprintf("; %s: %s/", remote, dir)
+		}
+	}
+	if tr.Retention <= 0 {
+		return where + ". They are kept until purged."
+	}
+	return where + fmt.Sprintf(". They are purged automatically after %d days.", int(tr.Retention.Hours()/24))
+}
+
+// excludeTrash returns filter with the trash folder of remote left out of
+// a recursive listing of dir. The rule goes ahead of any include rules, so
+// a search pattern cannot match inside the trash.
+func excludeTrash(tr *trash.Trash, remote, dir string, filter map[string]any) map[string]any {
+	rule := tr.ExcludeRule(remote, dir)
+	if rule == "" {
+		return filter
+	}
+	out := map[string]any{}
+	maps.Copy(out, filter)
+	rules := []string{"- " + rule}
+	if include, ok := out["IncludeRule"].([]string); ok {
+		// rclone reads include rules before all others
+		for _, r := range include {
+			rules = append(rules, "+ "+r)
+		}
+		rules = append(rules, "- /**")
+		delete(out, "IncludeRule")
+	}
+	out["FilterRule"] = rules
+	return out
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/joeblew999/plat-rclone/pkg/rclone"
+	"github.com/joeblew999/plat-rclone/pkg/router"
+	"github.com/joeblew999/plat-rclone/pkg/rpath"
+	"github.com/joeblew999/plat-rclone/templates"
+)
+
+// treeShown is how many folders a tree node lists; the rest are only
+// counted, but for one on the way to a folder being revealed.
+const treeShown = 500
+
+func registerTreeRoutes(r *router.Router, rc *rclone.Client) {
+	// API: List the folders in a tree node as it is first opened
+	r.GET("/api/tree/{remote}", func(ctx *router.Context) error {
+		sse := ctx.SSE()
+		remote := ctx.Param("remote")
+		dir := rpath.Clean(ctx.Query("path"))
+		node, err := treeNode(rc, remote, dir, "")
+		if err != nil {
+			return sse.PatchTempl(templates.Toast("Listing folders failed: "+err.Error(), true))
+		}
+		return sse.PatchTempl(templates.TreeItem(node))
+	})
+
+	// API: Open the tree down to the folder at, as shown in the browser,
+	// listing the folders at each level on the way
+	r.GET("/api/tree", func(ctx *router.Context) error {
+		sse := ctx.SSE()
+		remote, dir, err := rclone.SplitFs(ctx.Query("at"))
+		if err != nil {
+			return sse.PatchTempl(templates.Toast(err.Error(), true))
+		}
+		dir = rpath.Clean(dir)
+		node, err := treeNode(rc, remote, "", dir)
+		if err != nil {
+			return sse.PatchTempl(templates.Toast("Listing folders failed: "+err.Error(), true))
+		}
+		return sse.PatchTempl(templates.TreeItem(node))
+	})
+}
+
+// treeNode lists the folders in dir, opening the one on the way to reveal,
+// if reveal is below dir, and so on down to it.
+func treeNode(rc *rclone.Client, remote, dir, reveal string) (templates.TreeNode, error) {
+	node := templates.TreeNode{Remote: remote, Path: dir, Name: rpath.Base(dir), Loaded: true, Open: true}
+	if dir == "" {
+		node.Name = remote + ":"
+	}
+	items, err := rc.ListOpt(remote, dir, map[string]any{"dirsOnly": true})
+	if err != nil {
+		return node, err
+	}
+	slices.SortFunc(items, func(a, b rclone.ListItem) int {
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
+	onPath := func(p string) bool { return p == reveal || strings.HasPrefix(reveal, p+"/") }
+	if len(items) > treeShown {
+		shown := items[:treeShown]
+		for _, item := range items[treeShown:] {
+			if onPath(rpath.Join(dir, item.Name)) {
+				shown = append(slices.Clip(shown), item)
+				break
+			}
+		}
+		node.More = len(items) - len(shown)
+		items = shown
+	}
+	for _, item := range items {
+		child := templates.TreeNode{Remote: remote, Path: rpath.Join(dir, item.Name), Name: item.Name}
+		if onPath(child.Path) {
+			if child, err = treeNode(rc, remote, child.Path, reveal); err != nil {
+				return node, err
+			}
+		}
+		node.Children = append(node.Children, child)
+	}
+	return node, nil
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/joeblew999/plat-rclone/pkg/audit"
+	"github.com/joeblew999/plat-rclone/pkg/prefs"
+	"github.com/joeblew999/plat-rclone/pkg/rclone"
+	"github.com/joeblew999/plat-rclone/pkg/router"
+	"github.com/joeblew999/plat-rclone/pkg/rpath"
+	"github.com/joeblew999/plat-rclone/templates"
+)
+
+const (
+	// maxUploadsShown is how many recent uploads the progress list keeps.
+	maxUploadsShown = 20
+	// uploadOverhead allows for the multipart headers around the files
+	// when the body is held to the upload limit.
+	uploadOverhead = 1 << 20
+	// uploadTick is how often upload progress is pushed to the browser.
+	uploadTick = 500 * time.Millisecond
+	// uploadWait is how long the progress stream waits for an upload to
+	// begin, as it can be opened just before the upload request arrives.
+	uploadWait = 5 * time.Second
+)
+
+// upload is one file streamed through the upload endpoint.
+type upload struct {
+	ID       int64
+	Remote   string
+	Path     string
+	Bytes    int64
+	Started  time.Time
+	Finished time.Time
+	Err      string
+}
+
+// uploadTracker records upload progress for the browser to follow.
+type uploadTracker struct {
+	mu      sync.Mutex
+	nextID  int64
+	recent  []*upload     // most recent first
+	changed chan struct{} // closed when an upload starts, grows or ends
+}
+
+func newUploadTracker() *uploadTracker {
+	return &uploadTracker{changed: make(chan struct{})}
+}
+
+// notify wakes everyone following progress. t.mu must be held.
+func (t *uploadTracker) notify() {
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+func (t *uploadTracker) start(remote, path string) *upload {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.nextID++
+	u := &upload{ID: t.nextID, Remote: remote, Path: path, Started: time.Now()}
+	t.recent = append([]*upload{u}, t.recent...)
+	if len(t.recent) > maxUploadsShown {
+		t.recent = t.recent[:maxUploadsShown]
+	}
+	t.notify()
+	return u
+}
+
+func (t *uploadTracker) add(u *upload, n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u.Bytes += int64(n)
+	t.notify()
+}
+
+func (t *uploadTracker) finish(u *upload, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u.Finished = time.Now()
+	if err != nil {
+		u.Err = err.Error()
+	}
+	t.notify()
+}
+
+// snapshot returns the recent uploads, whether any is still running, and
+// a channel closed when they next change.
+func (t *uploadTracker) snapshot() (list []upload, active bool, changed <-chan struct{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	list = make([]upload, len(t.recent))
+	for i, u := range t.recent {
+		list[i] = *u
+		active = active || u.Finished.IsZero()
+	}
+	return list, active, t.changed
+}
+
+// progressReader counts bytes into an upload. It keeps the error reading
+// the request failed with, which the remote's own error may not carry.
+type progressReader struct {
+	r       io.Reader
+	tracker *uploadTracker
+	upload  *upload
+	err     error
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.tracker.add(p.upload, n)
+	if err != nil && err != io.EOF {
+		p.err = err
+	}
+	return n, err
+}
+
+// removePartial deletes what an upload cut short by the size limit left
+// at remote:path, unless it is the file that was there before.
+func removePartial(rc *rclone.Client, remote, path string, before *rclone.ListItem) {
+	after, err := rc.Stat(remote, path)
+	if err != nil || after == nil || after.IsDir {
+		return
+	}
+	if before != nil && after.Size == before.Size && after.ModTime == before.ModTime {
+		return
+	}
+	if err := rc.Delete(remote, path); err != nil {
+		log.Printf("upload %s:%s: remove partial file: %v", remote, path, err)
+	}
+}
+
+func registerUploadRoutes(r *router.Router, rc *rclone.Client, maxSize int64, auditLog *audit.Log, userPrefs *prefs.Store, listings *listingRuns) {
+	tracker := newUploadTracker()
+
+	// API: Upload files into the browsed directory. The multipart body is
+	// streamed part by part straight to the remote, so it is read in full
+	// before the SSE response starts. maxSize limits the files sent
+	// together; a body declared larger is refused before any is read.
+	r.POST("/api/upload/{remote}", func(ctx *router.Context) error {
+		remote := ctx.Param("remote")
+		dir := rpath.Clean(ctx.Query("path"))
+		tooLarge := fmt.Errorf("the upload is larger than the %s limit", formatSize(maxSize))
+
+		if maxSize > 0 {
+			if ctx.Request.ContentLength > maxSize+uploadOverhead {
+				sse := ctx.SSE()
+				sse.PatchSignals(map[string]any{"uploading": false})
+				return sse.PatchTempl(templates.Toast("Upload refused: "+tooLarge.Error(), true))
+			}
+			ctx.Request.Body = http.MaxBytesReader(ctx.Response, ctx.Request.Body, maxSize+uploadOverhead)
+		}
+
+		var uploaded, failed int
+		var lastErr error
+		mr, err := ctx.Request.MultipartReader()
+		for err == nil {
+			part, perr := mr.NextPart()
+			if perr == io.EOF {
+				break
+			}
+			if perr != nil {
+				err = perr
+				var over *http.MaxBytesError
+				if errors.As(perr, &over) {
+					err = tooLarge
+				}
+				break
+			}
+			name := part.FileName()
+			if name == "" {
+				continue
+			}
+			target := rpath.Join(dir, name)
+			u := tracker.start(remote, target)
+			uerr := validName(name)
+			if uerr == nil {
+				before, _ := rc.Stat(remote, target)
+				body := &progressReader{r: part, tracker: tracker, upload: u}
+				uerr = rc.Upload(ctx.Request.Context(), remote, dir, name, body)
+				var over *http.MaxBytesError
+				if errors.As(body.err, &over) {
+					removePartial(rc, remote, target, before)
+					uerr = tooLarge
+				}
+			}
+			tracker.finish(u, uerr)
+			recordAudit(ctx, auditLog, audit.Entry{Action: "file.upload", Remote: remote, Path: target, Params: map[string]any{"bytes": u.Bytes}}, uerr)
+			if uerr != nil {
+				log.Printf("upload %s:%s: %v", remote, target, uerr)
+				failed, lastErr = failed+1, uerr
+				continue
+			}
+			uploaded++
+		}
+
+		sse := ctx.SSE()
+		sse.PatchSignals(map[string]any{"uploading": false})
+		if err := patchFileBrowser(ctx, sse, listings, userPrefs, remote, dir); err != nil {
+			return err
+		}
+		list, _, _ := tracker.snapshot()
+		sse.PatchTempl(templates.UploadList(uploadInfos(list)))
+		switch {
+		case err != nil:
+			return sse.PatchTempl(templates.Toast("Upload failed: "+err.Error(), true))
+		case failed > 0:
+			return sse.PatchTempl(templates.Toast(fmt.Sprintf("Uploaded %d files, %d failed: %v", uploaded, failed, lastErr), true))
+		}
+		return sse.PatchTempl(templates.Toast(fmt.Sprintf("Uploaded %d files", uploaded), false))
+	})
+
+	// API: Follow the progress of recent uploads until none is running,
+	// opened as an upload begins
+	r.GET("/api/uploads", func(ctx *router.Context) error {
+		sse := ctx.SSE()
+		done := ctx.Request.Context().Done()
+		wait := time.After(uploadWait)
+		seen := false
+		for {
+			list, active, changed := tracker.snapshot()
+			sse.PatchTempl(templates.UploadList(uploadInfos(list)))
+			seen = seen || active
+			if seen && !active {
+				return nil
+			}
+			select {
+			case <-changed:
+			case <-wait:
+				if !seen {
+					return nil
+				}
+			case <-done:
+				return nil
+			}
+			select {
+			case <-time.After(uploadTick):
+			case <-done:
+				return nil
+			}
+		}
+	})
+}
+
+func uploadInfos(list []upload) []templates.UploadInfo {
+	items := make([]templates.UploadInfo, len(list))
+	for i, u := range list {
+		status, end := "uploading", time.Now()
+		switch {
+		case u.Err != "":
+			status, end = "error", u.Finished
+		case !u.Finished.IsZero():
+			status, end = "done", u.Finished
+		}
+		speed := ""
+		if secs := end.Sub(u.Started).Seconds(); secs > 0 {
+			speed = formatSize(int64(float64(u.Bytes)/secs)) + "/s"
+		}
+		items[i] = templates.UploadInfo{
+			Target: u.Remote + ":" + u.Path,
+			Bytes:  formatSize(u.Bytes),
+			Speed:  speed,
+			Status: status,
+			Error:  u.Err,
+		}
+	}
+	return items
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/joeblew999/plat-rclone/pkg/datastar"
+	"github.com/joeblew999/plat-rclone/pkg/rclone"
+	"github.com/joeblew999/plat-rclone/pkg/router"
+	"github.com/joeblew999/plat-rclone/pkg/rpath"
+	"github.com/joeblew999/plat-rclone/pkg/trash"
+	"github.com/joeblew999/plat-rclone/pkg/usage"
+	"github.com/joeblew999/plat-rclone/templates"
+)
+
+const (
+	// usageShown is how many of a folder's largest entries are listed.
+	usageShown = 50
+	// usageTiles is how many of them get a tile in the treemap.
+	usageTiles = 30
+	// usageCached is how many recent scans are kept for drilling down
+	// without rescanning.
+	usageCached = 8
+)
+
+func registerUsageRoutes(r *router.Router, rc *rclone.Client, trashBin *trash.Trash, usageScans *usage.Cache) {
+	// What takes up the space below a folder. The page scans it, or
+	// shows it from an earlier scan of it or a folder above it.
+	r.Page("/usage/{remote}", func(ctx *router.Context) (string, error) {
+		return datastar.RenderTempl(templates.UsagePage(ctx.Param("remote"), rpath.Clean(ctx.Query("path"))))
+	})
+
+	// API: Show a folder's usage, scanning it unless a cached scan covers
+	// it or rescan is set. Progress is streamed while scanning; leaving the
+	// page stops the scan.
+	r.GET("/api/usage/{remote}", func(ctx *router.Context) error {
+		sse := ctx.SSE()
+		remote := ctx.Param("remote")
+		dir := rpath.Clean(ctx.Query("path"))
+
+		scan := usageScans.Get(remote, dir)
+		if scan != nil && trashBin.Holds(remote, dir) && !trashBin.Holds(remote, scan.Root) {
+			scan = nil // scans from outside the trash leave it out
+		}
+		if scan == nil || ctx.Query("rescan") != "" {
+			var err error
+			if scan, err = scanUsage(ctx, sse, rc, remote, dir, excludeTrash(trashBin, remote, dir, nil)); err != nil {
+				return sse.PatchTempl(templates.UsageError("Scan failed: " + err.Error()))
+			}
+			usageScans.Put(scan)
+		}
+		return sse.PatchTempl(templates.UsageTree(usageView(scan, dir)))
+	})
+}
+
+// scanUsage lists dir recursively, counting every file filter lets
+// through into a scan. operations/size counts the total alongside. Both
+// stop when the page is left.
+func scanUsage(ctx *router.Context, sse *datastar.SSE, rc *rclone.Client, remote, dir string, filter map[string]any) (*usage.Scan, error) {
+	scanCtx, cancel := context.WithCancel(ctx.Request.Context())
+	defer cancel() // also ends a count still running once the scan is done
+	scan := usage.NewScan(remote, dir)
+	type counted struct {
+		files, bytes int64
+		err          error
+	}
+	totals := make(chan counted, 1)
+	go func() {
+		files, bytes, err := rc.Count(scanCtx, remote, dir, filter)
+		totals <- counted{files, bytes, err}
+	}()
+
+	var mu sync.Mutex
+	done := make(chan error, 1)
+	go func() {
+		done <- rc.ListStream(scanCtx, remote, dir, map[string]any{"recurse": true, "filesOnly": true}, filter, func(item rclone.ListItem) error {
+			mu.Lock()
+			defer mu.Unlock()
+			scan.Add(item.Path, item.Size)
+			return nil
+		})
+	}()
+
+	tick := time.NewTicker(listingTick)
+	defer tick.Stop()
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				return nil, err
+			}
+			scan.Finish()
+			select {
+			case t := <-totals:
+				if t.err == nil {
+					scan.Counted, scan.CountedFiles, scan.CountedBytes = true, t.files, t.bytes
+				}
+			case <-time.After(listingWait):
+				// Too slow to wait for; the breakdown has a total too
+			}
+			return scan, nil
+		case <-tick.C:
+			mu.Lock()
+			files, size := scan.Tree.Files, scan.Tree.Size
+			mu.Unlock()
+			sse.PatchTempl(templates.UsageProgress(remote, dir, files, formatSize(size)))
+		}
+	}
+}
+
+// usageView lays out the folder dir of scan, largest entries first.
+func usageView(scan *usage.Scan, dir string) templates.UsageView {
+	node := scan.Find(dir)
+	v := templates.UsageView{
+		Remote:  scan.Remote,
+		Root:    scan.Root,
+		Path:    dir,
+		Size:    formatSize(node.Size),
+		Files:   node.Files,
+		Scanned: scan.Time.Format("2006-01-02 15:04:05"),
+	}
+	if scan.Counted {
+		v.RootSize, v.RootFiles = formatSize(scan.CountedBytes), scan.CountedFiles
+	}
+
+	children := node.Children[:min(len(node.Children), usageShown)]
+	var sizes []int64
+	for _, c := range children[:min(len(children), usageTiles)] {
+		if c.Size > 0 {
+			sizes = append(sizes, c.Size)
+		}
+	}
+	// The map is 16:9, like the tiles' container
+	tiles := usage.Treemap(sizes, 160, 90)
+	for i, c := range children {
+		e := templates.UsageEntry{
+			Name:  c.Name,
+			IsDir: c.IsDir,
+			Rest:  c.Rest,
+			Size:  formatSize(c.Size),
+			Files: c.Files,
+		}
+		if c.IsDir {
+			e.Path = rpath.Join(dir, c.Name)
+		}
+		if node.Size > 0 {
+			e.Percent = float64(c.Size) * 100 / float64(node.Size)
+		}
+		if i < len(tiles) {
+			t := tiles[i]
+			e.Tile = true
+			e.Left, e.Top, e.Width, e.Height = t.X/1.6, t.Y/0.9, t.W/1.6, t.H/0.9
+		}
+		v.Entries = append(v.Entries, e)
+	}
+	return v
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/joeblew999/plat-rclone/pkg/rclone"
+)
+
+// zipErrorsName is the archive entry listing files that could not be read.
+const zipErrorsName = "ZIP-ERRORS.txt"
+
+// storedExts are already compressed; deflating them again only costs CPU.
+var storedExts = map[string]bool{
+	".zip": true, ".gz": true, ".tgz": true, ".bz2": true, ".xz": true, ".zst": true, ".7z": true, ".rar": true,
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".heic": true,
+	".mp3": true, ".m4a": true, ".aac": true, ".ogg": true, ".flac": true, ".opus": true,
+	".mp4": true, ".m4v": true, ".mov": true, ".mkv": true, ".webm": true, ".avi": true,
+}
+
+// writeZip streams items, as listed by ListFiles for dir on remote, into a
+// zip archive on w. Nothing is staged on disk: each file is read from the
+// remote as it is written, and archive/zip switches to Zip64 for entries
+// or archives past 4 GiB. Files that fail to open are skipped and listed
+// in a ZIP-ERRORS.txt entry at the end.
+func writeZip(ctx context.Context, w io.Writer, rc *rclone.Client, remote, dir string, items []rclone.ListItem) error {
+	zw := zip.NewWriter(w)
+	var failures []string
+	for _, item := range items {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		src := path.Join(dir, item.Path)
+		in, err := rc.OpenFile(ctx, remote, src)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", item.Path, err))
+			continue
+		}
+		hdr := &zip.FileHeader{Name: item.Path, Method: zip.Deflate}
+		if storedExts[strings.ToLower(path.Ext(item.Name))] {
+			hdr.Method = zip.Store
+		}
+		if t, err := time.Parse(time.RFC3339Nano, item.ModTime); err == nil {
+			hdr.Modified = t
+		}
+		out, err := zw.CreateHeader(hdr)
+		if err == nil {
+			_, err = io.Copy(out, in)
+		}
+		in.Close()
+		if err != nil {
+			// The archive is already partly sent; all we can do is stop.
+			return fmt.Errorf("zip %s:%s: %w", remote, src, err)
+		}
+	}
+
+	if len(failures) > 0 {
+		log.Printf("zip %s:%s: %d files skipped", remote, dir, len(failures))
+		out, err := zw.Create(zipErrorsName)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "These files could not be read and are missing from the archive:\n\n%s\n", strings.Join(failures, "\n"))
+	}
+	return zw.Close()
+}
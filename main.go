@@ -170,12 +170,12 @@ func setupRoutes(rc *rclone.Client) *router.Router {
 
 	r.Page("/jobs", func(ctx *router.Context) (string, error) {
 		jobs, _ := getJobsInfo(rc)
-		return datastar.RenderTempl(templates.JobsPage(jobs))
+		return datastar.RenderTempl(templates.JobsPage(jobs, "", templates.QueueInfo{}, nil))
 	})
 
 	r.Page("/stats", func(ctx *router.Context) (string, error) {
 		stats, version := getStatsInfo(rc)
-		return datastar.RenderTempl(templates.StatsPage(stats, version))
+		return datastar.RenderTempl(templates.StatsPage(stats, version, templates.ChartsInfo{Window: "5m"}))
 	})
 
 	// API routes
@@ -210,7 +210,8 @@ func setupRoutes(rc *rclone.Client) *router.Router {
 				IsDir:   item.IsDir,
 			}
 		}
-		return sse.PatchTempl(templates.FileBrowser(name, path, fileItems))
+		all := templates.ListingState{Listed: len(items), Matched: len(items), Shown: len(items), Done: true}
+		return sse.PatchTempl(templates.FileBrowser(name, path, fileItems, templates.ListingView{Sort: "name", DirsFirst: true}, all))
 	})
 
 	r.DELETE("/api/remotes/{name}", func(ctx *router.Context) error {
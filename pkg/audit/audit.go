@@ -0,0 +1,290 @@
+// Package audit keeps an append-only log of mutating actions as JSON lines.
+// The active file is rotated once it grows past a size limit, and rotated
+// files are removed once they are older than the retention period or more
+// numerous than the backup limit.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	activeName    = "audit.log"
+	rotatedPrefix = "audit-"
+	rotatedLayout = "20060102T150405.000000000"
+)
+
+// Entry is one audited action.
+type Entry struct {
+	Time   time.Time      `json:"time"`
+	User   string         `json:"user,omitempty"` // set when the request was authenticated
+	IP     string         `json:"ip,omitempty"`
+	Action string         `json:"action"` // e.g. file.delete, remote.delete
+	Remote string         `json:"remote,omitempty"`
+	Path   string         `json:"path,omitempty"`
+	Params map[string]any `json:"params,omitempty"`
+	Result string         `json:"result"` // ok or error
+	Error  string         `json:"error,omitempty"`
+}
+
+// matches reports whether every word of query appears in the entry.
+func (e *Entry) matches(query string) bool {
+	if query == "" {
+		return true
+	}
+	params, _ := json.Marshal(e.Params)
+	haystack := strings.ToLower(strings.Join([]string{
+		e.User, e.IP, e.Action, e.Remote, e.Path, string(params), e.Result, e.Error,
+	}, " "))
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		if !strings.Contains(haystack, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// Log is an audit log in a directory of its own.
+type Log struct {
+	dir string
+
+	// MaxSize is the size in bytes at which the active file is rotated.
+	MaxSize int64
+	// MaxAge is how long rotated files are kept. Zero keeps them forever.
+	MaxAge time.Duration
+	// MaxBackups is how many rotated files are kept. Zero keeps them all.
+	MaxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// Open opens (or creates) the audit log in dir.
+func Open(dir string) (*Log, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	l := &Log{
+		dir:        dir,
+		MaxSize:    10 << 20,
+		MaxAge:     90 * 24 * time.Hour,
+		MaxBackups: 20,
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	if err := l.prune(); err != nil {
+		l.file.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Close closes the active file.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// Append writes an entry, rotating first if the active file is full.
+// A zero Time is set to now, and an empty Result is derived from Error.
+func (l *Log) Append(e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if e.Result == "" {
+		e.Result = "ok"
+		if e.Error != "" {
+			e.Result = "error"
+		}
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("marshal audit entry: %w", err)
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.MaxSize > 0 && l.size > 0 && l.size+int64(len(data)) > l.MaxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(data)
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("write audit log: %w", err)
+	}
+	return nil
+}
+
+// Search returns entries matching query, newest first, reading rotated
+// files only as far as needed. An empty query matches everything;
+// limit <= 0 means no limit.
+//
+// The files are read without holding the log, so appends carry on while
+// it searches. It sees the entries written before it started; if the
+// active file is rotated meanwhile, those are read from the rotated copy.
+func (l *Log) Search(query string, limit int) ([]Entry, error) {
+	l.mu.Lock()
+	files, err := l.rotated()
+	size := l.size
+	l.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	active, err := readFile(filepath.Join(l.dir, activeName), size)
+	if err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	now, err := l.rotated()
+	l.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range now {
+		if len(files) == 0 || name > files[len(files)-1] {
+			// The file read as active may have been replaced; the one it
+			// was renamed to is the first rotated since
+			if active, err = readFile(filepath.Join(l.dir, name), size); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	// Newest file first: the active one, then rotated files by name.
+	var out []Entry
+	for i := len(files); i >= 0; i-- {
+		entries := active
+		if i < len(files) {
+			if entries, err = readFile(filepath.Join(l.dir, files[i]), -1); err != nil {
+				return nil, err
+			}
+		}
+		for j := len(entries) - 1; j >= 0; j-- {
+			if entries[j].matches(query) {
+				out = append(out, entries[j])
+				if limit > 0 && len(out) >= limit {
+					return out, nil
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+func (l *Log) open() error {
+	f, err := os.OpenFile(filepath.Join(l.dir, activeName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("open audit log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("open audit log: %w", err)
+	}
+	l.file, l.size = f, info.Size()
+	return nil
+}
+
+// rotate renames the active file aside, starts a new one and applies the
+// retention policy. Callers must hold l.mu.
+func (l *Log) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("rotate audit log: %w", err)
+	}
+	name := rotatedPrefix + time.Now().UTC().Format(rotatedLayout) + ".log"
+	if err := os.Rename(filepath.Join(l.dir, activeName), filepath.Join(l.dir, name)); err != nil {
+		return fmt.Errorf("rotate audit log: %w", err)
+	}
+	if err := l.open(); err != nil {
+		return err
+	}
+	return l.prune()
+}
+
+// prune removes rotated files beyond MaxBackups or older than MaxAge.
+// Callers must hold l.mu.
+func (l *Log) prune() error {
+	files, err := l.rotated()
+	if err != nil {
+		return err
+	}
+	for i, name := range files {
+		expired := false
+		if l.MaxBackups > 0 && len(files)-i > l.MaxBackups {
+			expired = true
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, rotatedPrefix), ".log")
+		if t, err := time.Parse(rotatedLayout, stamp); err == nil && l.MaxAge > 0 && time.Since(t) > l.MaxAge {
+			expired = true
+		}
+		if expired {
+			if err := os.Remove(filepath.Join(l.dir, name)); err != nil {
+				return fmt.Errorf("prune audit log: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// rotated lists rotated files, oldest first.
+func (l *Log) rotated() ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(l.dir, rotatedPrefix+"*.log"))
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(matches))
+	for i, m := range matches {
+		names[i] = filepath.Base(m)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// readFile reads the entries in the first size bytes of the file at path,
+// or all of it if size is negative. A file pruned meanwhile has none.
+func readFile(path string, size int64) ([]Entry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read audit log: %w", err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if size >= 0 {
+		r = io.LimitReader(f, size)
+	}
+	var entries []Entry
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			continue // a torn write after a crash; skip the line
+		}
+		entries = append(entries, e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read audit log: %w", err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,206 @@
+// Package dupes finds files with the same content in several places, on
+// one remote or across remotes, in the manner of rclone dedupe.
+//
+// Only files of the same size can be the same, so files are first grouped
+// by size, and only those that share a size need hashing. Remotes do not
+// all support the same hashes; a file that shares no hash type with any
+// other of its size is taken to be the same as those of its name.
+package dupes
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// File is a file that may have copies elsewhere.
+type File struct {
+	Remote  string
+	Path    string // from the remote's root
+	Name    string
+	Size    int64
+	ModTime string
+	Hashes  map[string]string // filled in for candidates only
+}
+
+// Group is two or more files with the same content.
+type Group struct {
+	Size  int64
+	By    string // the hash type the files matched on, or "" for size and name
+	Hash  string
+	Files []File
+}
+
+// Wasted is the space taken by every copy but one.
+func (g Group) Wasted() int64 {
+	return g.Size * int64(len(g.Files)-1)
+}
+
+// BySize returns the sets of two or more files of the same size, largest
+// first. Only these can hold duplicates. Empty files are left out, as
+// they are all alike and take no space.
+func BySize(files []File) [][]File {
+	sizes := map[int64][]File{}
+	for _, f := range files {
+		if f.Size > 0 {
+			sizes[f.Size] = append(sizes[f.Size], f)
+		}
+	}
+	var sets [][]File
+	for _, set := range sizes {
+		if len(set) > 1 {
+			sets = append(sets, set)
+		}
+	}
+	slices.SortFunc(sets, func(a, b []File) int {
+		return cmp.Compare(b[0].Size, a[0].Size)
+	})
+	return sets
+}
+
+// Match splits files of one size into groups of the same content. Two
+// files are the same if they have the same value for a hash type both
+// have. Only files that share no hash type with any other in set are
+// compared by name, and then only with each other.
+func Match(set []File) []Group {
+	parent := make([]int, len(set))
+	for i := range parent {
+		parent[i] = i
+	}
+	find := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	holders := map[string]int{}
+	for _, f := range set {
+		for name, value := range f.Hashes {
+			if value != "" {
+				holders[name]++
+			}
+		}
+	}
+	first := map[[2]string]int{} // hash type and value to the first file with it
+	hashed := make([]bool, len(set))
+	for i, f := range set {
+		for name, value := range f.Hashes {
+			if value == "" || holders[name] < 2 {
+				continue
+			}
+			hashed[i] = true
+			key := [2]string{name, value}
+			if j, ok := first[key]; ok {
+				parent[find(i)] = find(j)
+			} else {
+				first[key] = i
+			}
+		}
+	}
+
+	keyed := map[string][]File{}
+	var keys []string
+	for i, f := range set {
+		key := "name:" + f.Name
+		if hashed[i] {
+			key = fmt.Sprint("hash:", find(i))
+		}
+		if _, ok := keyed[key]; !ok {
+			keys = append(keys, key)
+		}
+		keyed[key] = append(keyed[key], f)
+	}
+
+	var groups []Group
+	for _, key := range keys {
+		files := keyed[key]
+		if len(files) < 2 {
+			continue
+		}
+		g := Group{Size: files[0].Size, Files: files}
+		if strings.HasPrefix(key, "hash:") {
+			g.By = SharedHash(files)
+			if g.By != "" {
+				g.Hash = files[0].Hashes[g.By]
+			} else {
+				g.By = strings.Join(linkingHashes(files), "+")
+			}
+		}
+		groups = append(groups, g)
+	}
+	return groups
+}
+
+// linkingHashes returns the hash types two or more of files have the same
+// value for, md5 and sha1 first, for a group no one type covers.
+func linkingHashes(files []File) []string {
+	seen := map[[2]string]bool{}
+	linked := map[string]bool{}
+	for _, f := range files {
+		for name, value := range f.Hashes {
+			if value == "" {
+				continue
+			}
+			if key := [2]string{name, value}; seen[key] {
+				linked[name] = true
+			} else {
+				seen[key] = true
+			}
+		}
+	}
+	return preferred(slices.Collect(maps.Keys(linked)))
+}
+
+// SharedHash is the hash type every file in set has a value for: md5 if
+// they all have it, then sha1, then the first other in alphabetical
+// order. It is "" if there is none.
+func SharedHash(set []File) string {
+	if len(set) == 0 {
+		return ""
+	}
+	var shared []string
+	for name, value := range set[0].Hashes {
+		if value != "" {
+			shared = append(shared, name)
+		}
+	}
+	shared = slices.DeleteFunc(shared, func(name string) bool {
+		for _, f := range set[1:] {
+			if f.Hashes[name] == "" {
+				return true
+			}
+		}
+		return false
+	})
+	if shared = preferred(shared); len(shared) > 0 {
+		return shared[0]
+	}
+	return ""
+}
+
+// preferred sorts hash types md5 first, then sha1, then alphabetically.
+func preferred(names []string) []string {
+	rank := func(name string) int {
+		switch name {
+		case "md5":
+			return 0
+		case "sha1":
+			return 1
+		}
+		return 2
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		return cmp.Or(cmp.Compare(rank(a), rank(b)), cmp.Compare(a, b))
+	})
+	return names
+}
+
+// Sort orders groups by the space they waste, most first.
+func Sort(groups []Group) {
+	slices.SortStableFunc(groups, func(a, b Group) int {
+		return cmp.Compare(b.Wasted(), a.Wasted())
+	})
+}
@@ -0,0 +1,129 @@
+package dupes
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// file is a 100 byte file at path with the given hash type/value pairs.
+func file(path string, hashes ...string) File {
+	f := File{Remote: "r", Path: path, Name: path[strings.LastIndex(path, "/")+1:], Size: 100}
+	if len(hashes) > 0 {
+		f.Hashes = map[string]string{}
+		for i := 0; i+1 < len(hashes); i += 2 {
+			f.Hashes[hashes[i]] = hashes[i+1]
+		}
+	}
+	return f
+}
+
+// summary lists each group as "by:path,path".
+func summary(groups []Group) []string {
+	var out []string
+	for _, g := range groups {
+		var paths []string
+		for _, f := range g.Files {
+			paths = append(paths, f.Path)
+		}
+		out = append(out, g.By+":"+strings.Join(paths, ","))
+	}
+	return out
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name string
+		set  []File
+		want []string
+	}{
+		{
+			name: "same md5",
+			set:  []File{file("a/x", "md5", "1"), file("b/y", "md5", "1"), file("c/z", "md5", "2")},
+			want: []string{"md5:a/x,b/y"},
+		},
+		{
+			name: "md5 preferred over sha1",
+			set:  []File{file("a/x", "sha1", "s", "md5", "1"), file("b/x", "md5", "1", "sha1", "s")},
+			want: []string{"md5:a/x,b/x"},
+		},
+		{
+			name: "same name but different hash",
+			set:  []File{file("a/x", "md5", "1"), file("b/x", "md5", "2")},
+			want: nil,
+		},
+		{
+			name: "no hashes at all falls back to name",
+			set:  []File{file("a/x"), file("b/x"), file("c/y")},
+			want: []string{":a/x,b/x"},
+		},
+		{
+			name: "mixed types compared where they overlap",
+			set: []File{
+				file("s3/x", "md5", "1"),
+				file("local/x", "md5", "1", "sha1", "s"),
+				file("drive/x", "sha1", "s"),
+				file("drive/other", "sha1", "t"),
+			},
+			want: []string{"md5+sha1:s3/x,local/x,drive/x"},
+		},
+		{
+			name: "hashed files do not match an unhashed one by name",
+			set: []File{
+				file("a/x", "md5", "1"),
+				file("b/x", "md5", "2"),
+				file("crypt/x"),
+			},
+			want: nil,
+		},
+		{
+			name: "only files sharing no hash type fall back to name",
+			set: []File{
+				file("a/x", "md5", "1"),
+				file("b/y", "md5", "1"),
+				file("crypt/z"),
+				file("other/z", "quickxor", "q"),
+				file("a/z", "md5", "3"),
+			},
+			want: []string{"md5:a/x,b/y", ":crypt/z,other/z"},
+		},
+		{
+			name: "empty hash values are missing",
+			set:  []File{file("a/x", "md5", ""), file("b/x", "md5", "")},
+			want: []string{":a/x,b/x"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := summary(Match(tt.set))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Match = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchHash(t *testing.T) {
+	groups := Match([]File{file("a/x", "sha1", "s", "md5", "1"), file("b/x", "md5", "1")})
+	if len(groups) != 1 || groups[0].By != "md5" || groups[0].Hash != "1" {
+		t.Errorf("Match = %+v, want one group by md5 1", groups)
+	}
+}
+
+func TestBySize(t *testing.T) {
+	files := []File{
+		{Path: "a", Size: 10}, {Path: "b", Size: 20}, {Path: "c", Size: 10},
+		{Path: "d", Size: 20}, {Path: "e", Size: 30}, {Path: "f"}, {Path: "g"},
+	}
+	var got []string
+	for _, set := range BySize(files) {
+		var paths []string
+		for _, f := range set {
+			paths = append(paths, f.Path)
+		}
+		got = append(got, strings.Join(paths, ","))
+	}
+	if want := []string{"b,d", "a,c"}; !slices.Equal(got, want) {
+		t.Errorf("BySize = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,293 @@
+// Package history keeps a persistent record of rclone jobs.
+// Records live in an embedded bbolt database so they survive restarts
+// of both plat-rclone and the rclone daemon.
+package history
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/joeblew999/plat-rclone/internal/storage"
+	"github.com/joeblew999/plat-rclone/pkg/rclone"
+)
+
+var (
+	jobsBucket    = []byte("jobs")
+	runningBucket = []byte("running") // keys of records not yet finished
+	startedBucket = []byte("started") // start time and key to key, oldest first; its sequence counts records
+)
+
+// Record is the stored summary of a single rclone job.
+type Record struct {
+	Key       string           `json:"key"`
+	ExecuteID string           `json:"executeId"`
+	JobID     int64            `json:"jobId"`
+	Group     string           `json:"group"`
+	Transfer  *rclone.Transfer `json:"transfer,omitempty"` // set when started by plat-rclone
+	StartTime time.Time        `json:"startTime"`
+	EndTime   time.Time        `json:"endTime,omitzero"`
+	Finished  bool             `json:"finished"`
+	Success   bool             `json:"success"`
+	Error     string           `json:"error,omitempty"`
+	Bytes     int64            `json:"bytes"`
+	Transfers int64            `json:"transfers"`
+	Errors    int64            `json:"errors"`
+	Stats     map[string]any   `json:"stats,omitempty"` // final core/stats for the job's group
+}
+
+// Key returns the record key for a job. rclone job IDs restart at 1
+// whenever rclone restarts, so they are qualified by the execute ID.
+func Key(executeID string, jobID int64) string {
+	return fmt.Sprintf("%s-%d", executeID, jobID)
+}
+
+// Status returns running, finished or error.
+func (r *Record) Status() string {
+	switch {
+	case !r.Finished:
+		return "running"
+	case r.Success:
+		return "finished"
+	default:
+		return "error"
+	}
+}
+
+// Duration returns how long the job ran, or has been running.
+func (r *Record) Duration() time.Duration {
+	if r.EndTime.IsZero() {
+		return time.Since(r.StartTime)
+	}
+	return r.EndTime.Sub(r.StartTime)
+}
+
+// matches reports whether every word of query appears in the record.
+func (r *Record) matches(query string) bool {
+	if query == "" {
+		return true
+	}
+	fields := []string{r.Group, r.Status(), r.Error, fmt.Sprint(r.JobID)}
+	if t := r.Transfer; t != nil {
+		fields = append(fields, t.Op, t.SrcFs(), t.DstFs())
+	}
+	haystack := strings.ToLower(strings.Join(fields, " "))
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		if !strings.Contains(haystack, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// Store is a bbolt-backed job history. Finished records older than MaxAge,
+// and the oldest beyond MaxRecords, are pruned as records are written.
+type Store struct {
+	db *bolt.DB
+
+	// MaxAge is how long finished records are kept. Zero keeps them.
+	MaxAge time.Duration
+	// MaxRecords is how many records are kept. Zero means no limit.
+	MaxRecords int
+}
+
+// Open opens (or creates) the history database at path.
+func Open(path string) (*Store, error) {
+	db, err := storage.OpenBolt(path, jobsBucket)
+	if err != nil {
+		return nil, fmt.Errorf("open history: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		jobs := tx.Bucket(jobsBucket)
+		if tx.Bucket(startedBucket) != nil {
+			return nil
+		}
+		// A database from before the indexes: build them once
+		if _, err := tx.CreateBucket(runningBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucket(startedBucket); err != nil {
+			return err
+		}
+		return jobs.ForEach(func(k, v []byte) error {
+			var r Record
+			if err := json.Unmarshal(v, &r); err != nil {
+				return fmt.Errorf("unmarshal record %s: %w", k, err)
+			}
+			return index(tx, nil, &r)
+		})
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("init history: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Put inserts or replaces a record, then prunes old records.
+func (s *Store) Put(r *Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("marshal record: %w", err)
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		jobs := tx.Bucket(jobsBucket)
+		var old *Record
+		if prev := jobs.Get([]byte(r.Key)); prev != nil {
+			old = new(Record)
+			if err := json.Unmarshal(prev, old); err != nil {
+				return fmt.Errorf("unmarshal record %s: %w", r.Key, err)
+			}
+		}
+		if err := jobs.Put([]byte(r.Key), data); err != nil {
+			return err
+		}
+		if err := index(tx, old, r); err != nil {
+			return err
+		}
+		return s.prune(tx)
+	})
+}
+
+// index updates the running and started indexes for r, which replaces
+// old, if there was one.
+func index(tx *bolt.Tx, old, r *Record) error {
+	started := tx.Bucket(startedBucket)
+	if old == nil {
+		if _, err := started.NextSequence(); err != nil {
+			return err
+		}
+	} else if !old.StartTime.Equal(r.StartTime) {
+		if err := started.Delete(startedKey(old)); err != nil {
+			return err
+		}
+	}
+	if err := started.Put(startedKey(r), []byte(r.Key)); err != nil {
+		return err
+	}
+	if r.Finished {
+		return tx.Bucket(runningBucket).Delete([]byte(r.Key))
+	}
+	return tx.Bucket(runningBucket).Put([]byte(r.Key), nil)
+}
+
+// startedKey orders records by start time in the started index.
+func startedKey(r *Record) []byte {
+	key := binary.BigEndian.AppendUint64(nil, uint64(r.StartTime.UnixNano()))
+	return append(key, r.Key...)
+}
+
+// prune deletes finished records past MaxAge or MaxRecords, oldest first.
+// Records still running are kept whatever their age.
+func (s *Store) prune(tx *bolt.Tx) error {
+	if s.MaxAge <= 0 && s.MaxRecords <= 0 {
+		return nil
+	}
+	jobs, running, started := tx.Bucket(jobsBucket), tx.Bucket(runningBucket), tx.Bucket(startedBucket)
+	count := int(started.Sequence())
+	excess := 0
+	if s.MaxRecords > 0 {
+		excess = count - s.MaxRecords
+	}
+	var cutoff []byte
+	if s.MaxAge > 0 {
+		cutoff = binary.BigEndian.AppendUint64(nil, uint64(time.Now().Add(-s.MaxAge).UnixNano()))
+	}
+	c := started.Cursor()
+	for k, key := c.First(); k != nil; {
+		if excess <= 0 && (cutoff == nil || bytes.Compare(k[:8], cutoff) >= 0) {
+			break
+		}
+		if running.Get(key) != nil {
+			k, key = c.Next()
+			continue
+		}
+		next := slices.Clone(k) // k is not valid once deleted
+		if err := jobs.Delete(key); err != nil {
+			return err
+		}
+		if err := c.Delete(); err != nil {
+			return err
+		}
+		count--
+		excess--
+		k, key = c.Seek(next)
+	}
+	return started.SetSequence(uint64(count))
+}
+
+// Get returns the record for key, or nil if there is none.
+func (s *Store) Get(key string) (*Record, error) {
+	var r *Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(jobsBucket).Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		r = new(Record)
+		return json.Unmarshal(data, r)
+	})
+	return r, err
+}
+
+// Search returns records matching query, newest first.
+// An empty query matches everything; limit <= 0 means no limit.
+func (s *Store) Search(query string, limit int) ([]Record, error) {
+	var records []Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).ForEach(func(k, v []byte) error {
+			var r Record
+			if err := json.Unmarshal(v, &r); err != nil {
+				return fmt.Errorf("unmarshal record %s: %w", k, err)
+			}
+			if r.matches(query) {
+				records = append(records, r)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].StartTime.After(records[j].StartTime)
+	})
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+	return records, nil
+}
+
+// unfinished returns all records not yet marked finished.
+func (s *Store) unfinished() ([]Record, error) {
+	var out []Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		jobs := tx.Bucket(jobsBucket)
+		return tx.Bucket(runningBucket).ForEach(func(k, _ []byte) error {
+			data := jobs.Get(k)
+			if data == nil {
+				return nil
+			}
+			var r Record
+			if err := json.Unmarshal(data, &r); err != nil {
+				return fmt.Errorf("unmarshal record %s: %w", k, err)
+			}
+			out = append(out, r)
+			return nil
+		})
+	})
+	return out, err
+}
@@ -0,0 +1,201 @@
+package history
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joeblew999/plat-rclone/pkg/rclone"
+)
+
+// Tracker polls rclone for jobs and records them in a Store.
+type Tracker struct {
+	rc    *rclone.Client
+	store *Store
+
+	// MinDuration is how long a job without a custom group must run before
+	// it is recorded. rclone registers every RC call as a job, including the
+	// quick synchronous calls plat-rclone itself makes, so these are skipped.
+	MinDuration time.Duration
+
+	// OnFinish, if set, is called once for each recorded job when it is
+	// first seen finished. It is called with the tracker locked, so it
+	// must not block.
+	OnFinish func(rec Record)
+
+	mu sync.Mutex
+}
+
+// NewTracker creates a Tracker recording into store.
+func NewTracker(rc *rclone.Client, store *Store) *Tracker {
+	return &Tracker{rc: rc, store: store, MinDuration: time.Second}
+}
+
+// Store returns the underlying history store.
+func (t *Tracker) Store() *Store {
+	return t.store
+}
+
+// Started records a job launched by plat-rclone together with its parameters.
+func (t *Tracker) Started(jobID int64, tr rclone.Transfer) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	job, err := t.rc.GetJob(jobID)
+	if err != nil {
+		return err
+	}
+	key := Key(job.ExecuteID, job.ID)
+	rec, err := t.store.Get(key)
+	if err != nil {
+		return err
+	}
+	if rec != nil && rec.Finished {
+		// A poll already closed it out; just attach the parameters.
+		rec.Transfer = &tr
+		return t.store.Put(rec)
+	}
+
+	rec = &Record{Key: key, ExecuteID: job.ExecuteID, JobID: job.ID, Transfer: &tr}
+	t.update(rec, job)
+	if err := t.store.Put(rec); err != nil {
+		return err
+	}
+	if rec.Finished {
+		t.finished(rec)
+	}
+	return nil
+}
+
+// Run polls rclone every interval until ctx is cancelled.
+func (t *Tracker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := t.Poll(); err != nil {
+			log.Printf("history: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll records the current state of every job rclone reports, and closes
+// out records for jobs that disappeared (expired, or rclone restarted)
+// before they were seen to finish.
+func (t *Tracker) Poll() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	jobs, err := t.rc.ListJobs()
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool, len(jobs))
+	for _, job := range jobs {
+		key := Key(job.ExecuteID, job.ID)
+		seen[key] = true
+
+		rec, err := t.store.Get(key)
+		if err != nil {
+			return err
+		}
+		switch {
+		case rec == nil && !t.observable(job):
+			continue
+		case rec == nil:
+			rec = &Record{Key: key, ExecuteID: job.ExecuteID, JobID: job.ID}
+		case rec.Finished:
+			continue
+		}
+
+		t.update(rec, &job)
+		if err := t.store.Put(rec); err != nil {
+			return err
+		}
+		if rec.Finished {
+			t.finished(rec)
+		}
+	}
+
+	unfinished, err := t.store.unfinished()
+	if err != nil {
+		return err
+	}
+	for _, rec := range unfinished {
+		if seen[rec.Key] {
+			continue
+		}
+		rec.Finished = true
+		if rec.Error == "" {
+			rec.Error = "job no longer reported by rclone"
+		}
+		if rec.EndTime.IsZero() {
+			rec.EndTime = time.Now()
+		}
+		if err := t.store.Put(&rec); err != nil {
+			return err
+		}
+		t.finished(&rec)
+	}
+	return nil
+}
+
+func (t *Tracker) finished(rec *Record) {
+	if t.OnFinish != nil {
+		t.OnFinish(*rec)
+	}
+}
+
+// observable reports whether a job seen in job/list is worth recording.
+func (t *Tracker) observable(job rclone.Job) bool {
+	if !strings.HasPrefix(job.Group, "job/") {
+		return true
+	}
+	if job.Finished {
+		return time.Duration(job.Duration*float64(time.Second)) >= t.MinDuration
+	}
+	return time.Since(parseTime(job.StartTime)) >= t.MinDuration
+}
+
+// update copies job state into rec, fetching final stats once finished.
+func (t *Tracker) update(rec *Record, job *rclone.Job) {
+	rec.Group = job.Group
+	rec.StartTime = parseTime(job.StartTime)
+	rec.Finished = job.Finished
+	rec.Success = job.Success
+	rec.Error = job.Error
+	if !job.Finished {
+		return
+	}
+
+	rec.EndTime = parseTime(job.EndTime)
+	stats, err := t.rc.GroupStats(job.Group)
+	if err != nil {
+		return
+	}
+	rec.Stats = stats
+	if b, ok := stats["bytes"].(float64); ok {
+		rec.Bytes = int64(b)
+	}
+	if n, ok := stats["transfers"].(float64); ok {
+		rec.Transfers = int64(n)
+	}
+	if n, ok := stats["errors"].(float64); ok {
+		rec.Errors = int64(n)
+	}
+	if e, ok := stats["lastError"].(string); ok && rec.Error == "" && !rec.Success {
+		rec.Error = e
+	}
+}
+
+func parseTime(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, s)
+	return t
+}
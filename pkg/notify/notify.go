@@ -0,0 +1,273 @@
+// Package notify delivers job completion notifications to generic JSON
+// webhooks, Slack-compatible webhooks and SMTP mailboxes.
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/joeblew999/plat-rclone/pkg/history"
+)
+
+// DefaultTemplate is the message used by channels without their own template.
+const DefaultTemplate = `plat-rclone: job {{.Group}} {{.Status}}` +
+	`{{if .Op}} ({{.Op}} {{.Src}} → {{.Dst}}){{end}}` +
+	` - {{bytes .Bytes}} in {{duration .Duration}}, {{.Transfers}} transfers, {{.Errors}} errors` +
+	`{{if .Error}}. Last error: {{.Error}}{{end}}`
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+var funcs = template.FuncMap{
+	"bytes":    formatBytes,
+	"duration": func(d time.Duration) string { return d.Round(time.Second).String() },
+}
+
+// Channel is a configured notification destination.
+type Channel struct {
+	Name     string `yaml:"name"`
+	Type     string `yaml:"type"`               // webhook, slack or email
+	On       string `yaml:"on,omitempty"`       // error (default) or always
+	Group    string `yaml:"group,omitempty"`    // only jobs whose group contains this
+	Template string `yaml:"template,omitempty"` // text/template, see DefaultTemplate
+	URL      string `yaml:"url,omitempty"`      // webhook and slack
+	SMTP     *SMTP  `yaml:"smtp,omitempty"`     // email
+}
+
+// SMTP holds the mail server settings of an email channel.
+type SMTP struct {
+	Addr     string   `yaml:"addr"` // host:port
+	Username string   `yaml:"username,omitempty"`
+	Password string   `yaml:"password,omitempty"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+}
+
+// Validate checks the channel is complete and its template parses.
+func (c Channel) Validate() error {
+	if !validName.MatchString(c.Name) {
+		return fmt.Errorf("channel name %q must only contain letters, digits, '.', '_' or '-'", c.Name)
+	}
+	switch c.On {
+	case "", "error", "always":
+	default:
+		return fmt.Errorf("channel %s: on must be error or always", c.Name)
+	}
+	switch c.Type {
+	case "webhook", "slack":
+		if !strings.HasPrefix(c.URL, "http://") && !strings.HasPrefix(c.URL, "https://") {
+			return fmt.Errorf("channel %s: url must start with http:// or https://", c.Name)
+		}
+	case "email":
+		if c.SMTP == nil || c.SMTP.Addr == "" || c.SMTP.From == "" || len(c.SMTP.To) == 0 {
+			return fmt.Errorf("channel %s: email needs an SMTP server, a sender and recipients", c.Name)
+		}
+		for _, addr := range append([]string{c.SMTP.From}, c.SMTP.To...) {
+			if strings.ContainsAny(addr, "\r\n") {
+				return fmt.Errorf("channel %s: invalid address %q", c.Name, addr)
+			}
+		}
+	default:
+		return fmt.Errorf("channel %s: unknown type %q", c.Name, c.Type)
+	}
+	_, err := c.template()
+	return err
+}
+
+// Wants reports whether the channel should be notified of ev.
+func (c Channel) Wants(ev Event) bool {
+	if c.Group != "" && !strings.Contains(ev.Group, c.Group) {
+		return false
+	}
+	return c.On == "always" || ev.Status == "error"
+}
+
+func (c Channel) template() (*template.Template, error) {
+	text := c.Template
+	if strings.TrimSpace(text) == "" {
+		text = DefaultTemplate
+	}
+	tmpl, err := template.New(c.Name).Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("channel %s: template: %w", c.Name, err)
+	}
+	return tmpl, nil
+}
+
+// Message renders the channel's template for ev.
+func (c Channel) Message(ev Event) (string, error) {
+	tmpl, err := c.template()
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, ev); err != nil {
+		return "", fmt.Errorf("channel %s: template: %w", c.Name, err)
+	}
+	return buf.String(), nil
+}
+
+// Event describes a finished job.
+type Event struct {
+	JobID     int64         `json:"jobId"`
+	Group     string        `json:"group"`
+	Status    string        `json:"status"` // finished or error
+	Op        string        `json:"op,omitempty"`
+	Src       string        `json:"src,omitempty"`
+	Dst       string        `json:"dst,omitempty"`
+	Bytes     int64         `json:"bytes"`
+	Transfers int64         `json:"transfers"`
+	Errors    int64         `json:"errors"`
+	StartTime time.Time     `json:"startTime"`
+	EndTime   time.Time     `json:"endTime"`
+	Duration  time.Duration `json:"-"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// FromRecord builds an event from a finished history record.
+func FromRecord(rec history.Record) Event {
+	ev := Event{
+		JobID:     rec.JobID,
+		Group:     rec.Group,
+		Status:    rec.Status(),
+		Bytes:     rec.Bytes,
+		Transfers: rec.Transfers,
+		Errors:    rec.Errors,
+		StartTime: rec.StartTime,
+		EndTime:   rec.EndTime,
+		Duration:  rec.Duration(),
+		Error:     rec.Error,
+	}
+	if t := rec.Transfer; t != nil {
+		ev.Op, ev.Src, ev.Dst = t.Op, t.SrcFs(), t.DstFs()
+	}
+	return ev
+}
+
+// SampleEvent is a failed job used to test a channel.
+func SampleEvent() Event {
+	end := time.Now()
+	return Event{
+		JobID:     42,
+		Group:     "test:notification",
+		Status:    "error",
+		Op:        "sync",
+		Src:       "source:photos",
+		Dst:       "backup:photos",
+		Bytes:     123 << 20,
+		Transfers: 17,
+		Errors:    1,
+		StartTime: end.Add(-95 * time.Second),
+		EndTime:   end,
+		Duration:  95 * time.Second,
+		Error:     "this is a test notification from plat-rclone",
+	}
+}
+
+// Delivery is the outcome of the last notification sent to a channel.
+type Delivery struct {
+	Time  time.Time
+	Error string
+}
+
+// Notifier sends events to the channels of a Store.
+type Notifier struct {
+	store *Store
+
+	// Client sends webhook requests.
+	Client *http.Client
+	// Timeout bounds each SMTP conversation.
+	Timeout time.Duration
+
+	mu   sync.Mutex
+	last map[string]Delivery
+}
+
+// New creates a Notifier for the channels in store.
+func New(store *Store) *Notifier {
+	return &Notifier{
+		store:   store,
+		Client:  &http.Client{Timeout: 15 * time.Second},
+		Timeout: 30 * time.Second,
+		last:    make(map[string]Delivery),
+	}
+}
+
+// Store returns the channel configuration.
+func (n *Notifier) Store() *Store {
+	return n.store
+}
+
+// Notify delivers ev to every channel that wants it, in the background.
+func (n *Notifier) Notify(ev Event) {
+	for _, ch := range n.store.List() {
+		if !ch.Wants(ev) {
+			continue
+		}
+		go func() {
+			if err := n.Send(ch, ev); err != nil {
+				log.Printf("notify: %s: %v", ch.Name, err)
+			}
+		}()
+	}
+}
+
+// Send delivers ev to a single channel and records the outcome.
+func (n *Notifier) Send(ch Channel, ev Event) error {
+	err := n.send(ch, ev)
+	d := Delivery{Time: time.Now()}
+	if err != nil {
+		d.Error = err.Error()
+	}
+	n.mu.Lock()
+	n.last[ch.Name] = d
+	n.mu.Unlock()
+	return err
+}
+
+// Last returns the most recent delivery to the named channel.
+func (n *Notifier) Last(name string) (Delivery, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	d, ok := n.last[name]
+	return d, ok
+}
+
+func (n *Notifier) send(ch Channel, ev Event) error {
+	msg, err := ch.Message(ev)
+	if err != nil {
+		return err
+	}
+	switch ch.Type {
+	case "webhook":
+		return n.postJSON(ch.URL, webhookPayload{
+			Event:           ev,
+			DurationSeconds: ev.Duration.Seconds(),
+			Text:            msg,
+		})
+	case "slack":
+		return n.postJSON(ch.URL, map[string]string{"text": msg})
+	case "email":
+		return n.sendMail(ch.SMTP, fmt.Sprintf("plat-rclone: job %s %s", ev.Group, ev.Status), msg)
+	}
+	return fmt.Errorf("unknown type %q", ch.Type)
+}
+
+func formatBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(b)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,327 @@
+package notify
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// received is one request a test webhook got.
+type received struct {
+	contentType string
+	body        []byte
+}
+
+// webhookServer answers every POST with status and body, and hands what
+// it received to the test.
+func webhookServer(t *testing.T, status int, body string) (*httptest.Server, <-chan received) {
+	t.Helper()
+	got := make(chan received, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost {
+			t.Errorf("method = %s, want POST", r.Method)
+		}
+		got <- received{r.Header.Get("Content-Type"), data}
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, got
+}
+
+func TestSendWebhook(t *testing.T) {
+	srv, got := webhookServer(t, http.StatusNoContent, "")
+	n := New(nil)
+	ch := Channel{Name: "hook", Type: "webhook", URL: srv.URL, Template: "{{.Group}} {{.Status}}"}
+	ev := SampleEvent()
+	if err := n.Send(ch, ev); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	req := <-got
+	if req.contentType != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", req.contentType)
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(req.body, &payload); err != nil {
+		t.Fatalf("payload %s: %v", req.body, err)
+	}
+	want := map[string]any{
+		"jobId":           float64(ev.JobID),
+		"group":           ev.Group,
+		"status":          "error",
+		"op":              "sync",
+		"src":             ev.Src,
+		"dst":             ev.Dst,
+		"bytes":           float64(ev.Bytes),
+		"errors":          float64(1),
+		"error":           ev.Error,
+		"durationSeconds": float64(95),
+		"text":            "test:notification error",
+	}
+	for k, v := range want {
+		if payload[k] != v {
+			t.Errorf("payload[%q] = %v, want %v", k, payload[k], v)
+		}
+	}
+
+	d, ok := n.Last("hook")
+	if !ok || d.Error != "" || d.Time.IsZero() {
+		t.Errorf("Last = %+v, %v; want a successful delivery", d, ok)
+	}
+}
+
+func TestSendSlack(t *testing.T) {
+	srv, got := webhookServer(t, http.StatusOK, "ok")
+	n := New(nil)
+	ch := Channel{Name: "slack", Type: "slack", URL: srv.URL}
+	ev := SampleEvent()
+	if err := n.Send(ch, ev); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	req := <-got
+	var payload map[string]string
+	if err := json.Unmarshal(req.body, &payload); err != nil {
+		t.Fatalf("payload %s: %v", req.body, err)
+	}
+	want, _ := ch.Message(ev)
+	if len(payload) != 1 || payload["text"] != want {
+		t.Errorf("payload = %v, want only text %q", payload, want)
+	}
+	if !strings.Contains(want, "123.0 MB in 1m35s") {
+		t.Errorf("default message %q lacks the size and duration", want)
+	}
+}
+
+func TestSendWebhookFailures(t *testing.T) {
+	rejecting, _ := webhookServer(t, http.StatusInternalServerError, "boom\n")
+	gone := httptest.NewServer(http.NotFoundHandler())
+	gone.Close()
+
+	tests := []struct {
+		name, url, want string
+	}{
+		{"rejected", rejecting.URL, "500 Internal Server Error: boom"},
+		{"unreachable", gone.URL, "connection refused"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := New(nil)
+			ch := Channel{Name: "hook", Type: "webhook", URL: tt.url}
+			err := n.Send(ch, SampleEvent())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Send = %v, want an error containing %q", err, tt.want)
+			}
+			if d, ok := n.Last("hook"); !ok || d.Error != err.Error() {
+				t.Errorf("Last = %+v, %v; want the error recorded", d, ok)
+			}
+		})
+	}
+}
+
+func TestSendBadTemplate(t *testing.T) {
+	n := New(nil)
+	ch := Channel{Name: "hook", Type: "webhook", URL: "http://127.0.0.1:1", Template: "{{.Nope}}"}
+	if err := n.Send(ch, SampleEvent()); err == nil || !strings.Contains(err.Error(), "template") {
+		t.Fatalf("Send = %v, want a template error", err)
+	}
+}
+
+// mail is one message a fake SMTP server accepted.
+type mail struct {
+	auth string // decoded AUTH PLAIN credentials
+	from string
+	to   []string
+	data string
+}
+
+// fakeSMTP is just enough of an SMTP server to take one message per
+// connection. Recipients in reject are refused.
+type fakeSMTP struct {
+	ln     net.Listener
+	reject map[string]bool
+	mails  chan mail
+}
+
+func newFakeSMTP(t *testing.T, reject ...string) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTP{ln: ln, reject: map[string]bool{}, mails: make(chan mail, 1)}
+	for _, r := range reject {
+		s.reject[r] = true
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTP) addr() string {
+	// PlainAuth only sends credentials in the clear to localhost
+	_, port, _ := net.SplitHostPort(s.ln.Addr().String())
+	return net.JoinHostPort("localhost", port)
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	var m mail
+	tp.PrintfLine("220 localhost fake ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250-localhost")
+			tp.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			cred, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(arg, "PLAIN "))
+			m.auth = string(cred)
+			tp.PrintfLine("235 ok")
+		case "MAIL":
+			m.from = bracketed(arg)
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			to := bracketed(arg)
+			if s.reject[to] {
+				tp.PrintfLine("550 no such user %s", to)
+				continue
+			}
+			m.to = append(m.to, to)
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			m.data = string(data)
+			tp.PrintfLine("250 queued")
+			s.mails <- m
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+// bracketed returns the address in "FROM:<a@b> ..." or "TO:<a@b>".
+func bracketed(arg string) string {
+	_, rest, _ := strings.Cut(arg, "<")
+	addr, _, _ := strings.Cut(rest, ">")
+	return addr
+}
+
+func TestSendEmail(t *testing.T) {
+	srv := newFakeSMTP(t)
+	n := New(nil)
+	ch := Channel{Name: "mail", Type: "email", Template: "line one\nline two", SMTP: &SMTP{
+		Addr:     srv.addr(),
+		Username: "bot",
+		Password: "secret",
+		From:     "bot@example.com",
+		To:       []string{"a@example.com", "b@example.com"},
+	}}
+	if err := n.Send(ch, SampleEvent()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	m := <-srv.mails
+	if m.auth != "\x00bot\x00secret" {
+		t.Errorf("auth = %q, want the username and password", m.auth)
+	}
+	if m.from != "bot@example.com" || strings.Join(m.to, ",") != "a@example.com,b@example.com" {
+		t.Errorf("envelope = %s -> %v", m.from, m.to)
+	}
+	for _, want := range []string{
+		"From: bot@example.com\n",
+		"To: a@example.com, b@example.com\n",
+		"Subject: plat-rclone: job test:notification error\n",
+		"Content-Type: text/plain; charset=utf-8\n",
+		"\n\nline one\nline two\n",
+	} {
+		if !strings.Contains(m.data, want) {
+			t.Errorf("message lacks %q:\n%s", want, m.data)
+		}
+	}
+}
+
+func TestSendEmailFailures(t *testing.T) {
+	// A server that accepts but never greets, to hit the deadline
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, c := range conns {
+				c.Close()
+			}
+		}()
+		for {
+			conn, err := silent.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	tests := []struct {
+		name, addr, want string
+	}{
+		{"recipient refused", newFakeSMTP(t, "b@example.com").addr(), "no such user b@example.com"},
+		{"no greeting", silent.Addr().String(), "timeout"},
+		{"unreachable", closed.Addr().String(), "connection refused"},
+		{"bad address", "localhost", "smtp address"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := New(nil)
+			n.Timeout = 200 * time.Millisecond
+			ch := Channel{Name: "mail", Type: "email", SMTP: &SMTP{
+				Addr: tt.addr,
+				From: "bot@example.com",
+				To:   []string{"a@example.com", "b@example.com"},
+			}}
+			err := n.Send(ch, SampleEvent())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Send = %v, want an error containing %q", err, tt.want)
+			}
+			if d, ok := n.Last("mail"); !ok || d.Error == "" {
+				t.Errorf("Last = %+v, %v; want the error recorded", d, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/joeblew999/plat-rclone/internal/storage"
+)
+
+// Document is the on-disk format of the channel configuration.
+type Document struct {
+	Channels []Channel `yaml:"channels"`
+}
+
+// Store keeps notification channels in a YAML file. The file may hold
+// SMTP passwords, so it is only readable by its owner.
+type Store struct {
+	path     string
+	mu       sync.Mutex
+	channels []Channel
+}
+
+// Open loads the channel file at path. A missing file is an empty store.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read notifications: %w", err)
+	}
+	var doc Document
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse notifications: %w", err)
+	}
+	for _, c := range doc.Channels {
+		if err := c.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	s.channels = doc.Channels
+	return s, nil
+}
+
+// List returns all channels sorted by name.
+func (s *Store) List() []Channel {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := append([]Channel(nil), s.channels...)
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// Get returns the named channel.
+func (s *Store) Get(name string) (Channel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := s.index(name); i >= 0 {
+		return s.channels[i], nil
+	}
+	return Channel{}, fmt.Errorf("channel %q not found", name)
+}
+
+// Put creates or replaces a channel.
+func (s *Store) Put(c Channel) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := s.index(c.Name); i >= 0 {
+		s.channels[i] = c
+	} else {
+		s.channels = append(s.channels, c)
+	}
+	return s.save()
+}
+
+// Delete removes a channel.
+func (s *Store) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(name)
+	if i < 0 {
+		return fmt.Errorf("channel %q not found", name)
+	}
+	s.channels = append(s.channels[:i], s.channels[i+1:]...)
+	return s.save()
+}
+
+func (s *Store) index(name string) int {
+	for i, c := range s.channels {
+		if c.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// save writes the file atomically so a crash never leaves it truncated.
+func (s *Store) save() error {
+	data, err := storage.MarshalYAML(Document{Channels: s.channels})
+	if err != nil {
+		return fmt.Errorf("marshal notifications: %w", err)
+	}
+	if err := storage.WriteFile(s.path, data); err != nil {
+		return fmt.Errorf("write notifications: %w", err)
+	}
+	return nil
+}
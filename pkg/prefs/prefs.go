@@ -0,0 +1,114 @@
+// Package prefs remembers each user's view settings, such as how the file
+// browser is sorted, in a YAML file. Users are told apart by the name
+// they authenticated with; without authentication everyone shares the
+// "" user.
+package prefs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/joeblew999/plat-rclone/internal/storage"
+)
+
+// Sort orders, and the optional columns of the file browser.
+var (
+	SortKeys = []string{"name", "size", "modtime", "type"}
+	Columns  = []string{"mime", "hash", "tier", "id"}
+)
+
+// Browser is how a user likes the file browser laid out.
+type Browser struct {
+	Sort      string   `yaml:"sort"` // one of SortKeys
+	Desc      bool     `yaml:"desc,omitempty"`
+	DirsFirst bool     `yaml:"dirsFirst"`
+	Gallery   bool     `yaml:"gallery,omitempty"`
+	Columns   []string `yaml:"columns,omitempty"` // from Columns
+}
+
+// DefaultBrowser is used until a user changes anything.
+var DefaultBrowser = Browser{Sort: "name", DirsFirst: true}
+
+// Normalize drops unknown sort keys and columns.
+func (b Browser) Normalize() Browser {
+	if !slices.Contains(SortKeys, b.Sort) {
+		b.Sort = DefaultBrowser.Sort
+	}
+	var cols []string
+	for _, c := range Columns {
+		if slices.Contains(b.Columns, c) {
+			cols = append(cols, c)
+		}
+	}
+	b.Columns = cols
+	return b
+}
+
+// Prefs are one user's settings.
+type Prefs struct {
+	Browser Browser `yaml:"browser"`
+}
+
+// Store keeps every user's prefs in a YAML file.
+type Store struct {
+	path  string
+	mu    sync.Mutex
+	users map[string]Prefs
+}
+
+// Open loads the prefs file at path. A missing file is an empty store.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, users: map[string]Prefs{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read prefs: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &s.users); err != nil {
+		return nil, fmt.Errorf("parse prefs: %w", err)
+	}
+	if s.users == nil {
+		s.users = map[string]Prefs{}
+	}
+	return s, nil
+}
+
+// Browser returns the user's file browser settings.
+func (s *Store) Browser(user string) Browser {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.users[user]
+	if !ok {
+		return DefaultBrowser
+	}
+	return p.Browser.Normalize()
+}
+
+// SetBrowser saves the user's file browser settings.
+func (s *Store) SetBrowser(user string, b Browser) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.users[user]
+	p.Browser = b.Normalize()
+	s.users[user] = p
+	return s.save()
+}
+
+// save writes the file atomically so a crash never leaves it truncated.
+func (s *Store) save() error {
+	data, err := storage.MarshalYAML(s.users)
+	if err != nil {
+		return fmt.Errorf("marshal prefs: %w", err)
+	}
+	if err := storage.WriteFile(s.path, data); err != nil {
+		return fmt.Errorf("write prefs: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+// Package preview renders files for the browser's preview panel: Markdown
+// to HTML, JSON pretty-printed, source code with syntax highlighting and
+// anything else that looks like text as-is. Media files are not rendered
+// here; the panel plays or shows them straight from the download endpoint.
+package preview
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// TextLimit is how much of a file is read for a text preview. Longer
+// files are shown truncated, so a multi-GB log costs no more than this.
+const TextLimit = 256 << 10
+
+// Kind is how a file is previewed.
+type Kind string
+
+const (
+	Image    Kind = "image"
+	Audio    Kind = "audio"
+	Video    Kind = "video"
+	Markdown Kind = "markdown"
+	JSON     Kind = "json"
+	Code     Kind = "code"
+	Text     Kind = "text"
+)
+
+// ErrBinary is returned by Render for content that is not text.
+var ErrBinary = errors.New("no preview available for binary files")
+
+var kindsByExt = map[string]Kind{
+	".jpg": Image, ".jpeg": Image, ".png": Image, ".gif": Image, ".webp": Image, ".bmp": Image, ".svg": Image, ".avif": Image,
+	".mp3": Audio, ".m4a": Audio, ".aac": Audio, ".ogg": Audio, ".oga": Audio, ".opus": Audio, ".flac": Audio, ".wav": Audio,
+	".mp4": Video, ".m4v": Video, ".webm": Video, ".ogv": Video, ".mov": Video,
+	".md": Markdown, ".markdown": Markdown,
+	".json": JSON,
+}
+
+// Detect picks the preview kind for a file from its name. Names that are
+// neither media nor known source code are assumed to be text; Render
+// decides from the content whether they really are.
+func Detect(name string) Kind {
+	if k, ok := kindsByExt[strings.ToLower(path.Ext(name))]; ok {
+		return k
+	}
+	if lexer := lexers.Match(name); lexer != nil && lexer.Config().Name != "plaintext" {
+		return Code
+	}
+	return Text
+}
+
+// IsMedia reports whether k is shown by the browser from the file's URL
+// rather than rendered from its content.
+func (k Kind) IsMedia() bool {
+	return k == Image || k == Audio || k == Video
+}
+
+var (
+	markdown  = goldmark.New(goldmark.WithExtensions(extension.GFM))
+	formatter = chromahtml.New(chromahtml.WithClasses(false), chromahtml.TabWidth(4))
+	style     = styles.Get("monokai")
+)
+
+// Render turns the start of a file into HTML for the preview panel.
+// truncated says data is only a prefix of the file: JSON is then
+// highlighted as it is rather than reformatted, since it cannot parse.
+// Raw HTML in Markdown is dropped, so the result is safe to embed.
+func Render(name string, kind Kind, data []byte, truncated bool) (template.HTML, error) {
+	if truncated {
+		data = trimPartialRune(data)
+	}
+	if !IsText(data) {
+		return "", ErrBinary
+	}
+
+	switch kind {
+	case Markdown:
+		var buf bytes.Buffer
+		if err := markdown.Convert(data, &buf); err != nil {
+			return "", err
+		}
+		return template.HTML(buf.String()), nil
+	case JSON:
+		var buf bytes.Buffer
+		if !truncated && json.Indent(&buf, data, "", "  ") == nil {
+			data = buf.Bytes()
+		}
+		return highlight(lexers.Get("json"), data)
+	case Code:
+		return highlight(lexers.Match(name), data)
+	}
+	return template.HTML("<pre>" + template.HTMLEscapeString(string(data)) + "</pre>"), nil
+}
+
+// highlight formats data as a <pre> block coloured by lexer.
+func highlight(lexer chroma.Lexer, data []byte) (template.HTML, error) {
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, string(data))
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := formatter.Format(&buf, style, iterator); err != nil {
+		return "", err
+	}
+	return template.HTML(buf.String()), nil
+}
+
+// IsText reports whether data looks like UTF-8 text rather than binary.
+func IsText(data []byte) bool {
+	return utf8.Valid(data) && bytes.IndexByte(data, 0) < 0
+}
+
+// trimPartialRune drops a UTF-8 sequence cut in half by a size cap.
+func trimPartialRune(data []byte) []byte {
+	for i := 1; i < utf8.UTFMax && i <= len(data); i++ {
+		if utf8.RuneStart(data[len(data)-i]) {
+			if !utf8.FullRune(data[len(data)-i:]) {
+				return data[:len(data)-i]
+			}
+			break
+		}
+	}
+	return data
+}
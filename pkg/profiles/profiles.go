@@ -0,0 +1,240 @@
+// Package profiles stores named transfer settings as a YAML document,
+// so they can be kept in git and shared between machines.
+package profiles
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/joeblew999/plat-rclone/internal/storage"
+	"github.com/joeblew999/plat-rclone/pkg/rclone"
+)
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// Profile is a named, reusable copy/sync/move.
+type Profile struct {
+	Name   string         `yaml:"name"`
+	Op     string         `yaml:"op"`  // copy, sync or move
+	Src    string         `yaml:"src"` // remote:path
+	Dst    string         `yaml:"dst"` // remote:path
+	Group  string         `yaml:"group,omitempty"`
+	Filter map[string]any `yaml:"filter,omitempty"` // rclone _filter, e.g. IncludeRule
+	Config map[string]any `yaml:"config,omitempty"` // rclone _config, e.g. DryRun
+}
+
+// Document is the YAML import/export format.
+type Document struct {
+	Profiles []Profile `yaml:"profiles"`
+}
+
+// FromTransfer creates a profile from a transfer.
+func FromTransfer(name string, t rclone.Transfer) Profile {
+	return Profile{
+		Name:   name,
+		Op:     t.Op,
+		Src:    t.SrcFs(),
+		Dst:    t.DstFs(),
+		Group:  t.Group,
+		Filter: t.Filter,
+		Config: t.Config,
+	}
+}
+
+// Transfer converts the profile into a transfer ready to start.
+func (p Profile) Transfer() (rclone.Transfer, error) {
+	srcRemote, srcPath, err := rclone.SplitFs(p.Src)
+	if err != nil {
+		return rclone.Transfer{}, fmt.Errorf("profile %s: src: %w", p.Name, err)
+	}
+	dstRemote, dstPath, err := rclone.SplitFs(p.Dst)
+	if err != nil {
+		return rclone.Transfer{}, fmt.Errorf("profile %s: dst: %w", p.Name, err)
+	}
+	t := rclone.Transfer{
+		Op:        p.Op,
+		SrcRemote: srcRemote,
+		SrcPath:   srcPath,
+		DstRemote: dstRemote,
+		DstPath:   dstPath,
+		Group:     p.Group,
+		Filter:    p.Filter,
+		Config:    p.Config,
+	}
+	if t.Group == "" {
+		t.Group = "profile:" + p.Name
+	}
+	return t, nil
+}
+
+// Validate checks the profile is complete and runnable.
+func (p Profile) Validate() error {
+	if !validName.MatchString(p.Name) {
+		return fmt.Errorf("profile name %q must only contain letters, digits, '.', '_' or '-'", p.Name)
+	}
+	switch p.Op {
+	case "copy", "sync", "move":
+	default:
+		return fmt.Errorf("profile %s: unknown op %q", p.Name, p.Op)
+	}
+	_, err := p.Transfer()
+	return err
+}
+
+// Parse decodes and validates a YAML profiles document.
+func Parse(data []byte) ([]Profile, error) {
+	var doc Document
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse profiles: %w", err)
+	}
+	seen := make(map[string]bool, len(doc.Profiles))
+	for _, p := range doc.Profiles {
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+		if seen[p.Name] {
+			return nil, fmt.Errorf("duplicate profile %q", p.Name)
+		}
+		seen[p.Name] = true
+	}
+	return doc.Profiles, nil
+}
+
+// Store keeps profiles in a YAML file.
+type Store struct {
+	path     string
+	mu       sync.Mutex
+	profiles []Profile
+}
+
+// Open loads the profiles file at path. A missing file is an empty store.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read profiles: %w", err)
+	}
+	if s.profiles, err = Parse(data); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// List returns all profiles sorted by name.
+func (s *Store) List() []Profile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := append([]Profile(nil), s.profiles...)
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// Get returns the named profile.
+func (s *Store) Get(name string) (Profile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := index(s.profiles, name); i >= 0 {
+		return s.profiles[i], nil
+	}
+	return Profile{}, fmt.Errorf("profile %q not found", name)
+}
+
+// Put creates or replaces a profile.
+func (s *Store) Put(p Profile) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save(upsert(slices.Clone(s.profiles), p))
+}
+
+// Delete removes a profile.
+func (s *Store) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := index(s.profiles, name)
+	if i < 0 {
+		return fmt.Errorf("profile %q not found", name)
+	}
+	return s.save(slices.Delete(slices.Clone(s.profiles), i, i+1))
+}
+
+// Export returns all profiles as a YAML document.
+func (s *Store) Export() ([]byte, error) {
+	return marshal(s.List())
+}
+
+// Import merges a YAML document into the store, replacing profiles with
+// the same name. With replace set, existing profiles not in the document
+// are removed. It returns the number of profiles imported. If the file
+// cannot be written, the store is left as it was.
+func (s *Store) Import(data []byte, replace bool) (int, error) {
+	imported, err := Parse(data)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []Profile
+	if !replace {
+		list = slices.Clone(s.profiles)
+	}
+	for _, p := range imported {
+		list = upsert(list, p)
+	}
+	if err := s.save(list); err != nil {
+		return 0, err
+	}
+	return len(imported), nil
+}
+
+func index(list []Profile, name string) int {
+	for i, p := range list {
+		if p.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// upsert replaces the profile of p's name in list, or appends p.
+func upsert(list []Profile, p Profile) []Profile {
+	if i := index(list, p.Name); i >= 0 {
+		list[i] = p
+		return list
+	}
+	return append(list, p)
+}
+
+// marshal encodes a Document with the two-space indent usual in git repos.
+func marshal(list []Profile) ([]byte, error) {
+	return storage.MarshalYAML(Document{Profiles: list})
+}
+
+// save writes list to the file, atomically so a crash never leaves it
+// truncated, and only then makes it the store's profiles. Callers must
+// hold s.mu.
+func (s *Store) save(list []Profile) error {
+	data, err := marshal(list)
+	if err != nil {
+		return fmt.Errorf("marshal profiles: %w", err)
+	}
+	if err := storage.WriteFile(s.path, data); err != nil {
+		return fmt.Errorf("write profiles: %w", err)
+	}
+	s.profiles = list
+	return nil
+}
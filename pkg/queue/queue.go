@@ -0,0 +1,360 @@
+// Package queue admits transfers to rclone under concurrency limits.
+// rclone starts every async job immediately, so several large copies
+// submitted together compete for the same links. The queue holds them
+// back until a slot is free, globally and per remote.
+package queue
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/joeblew999/plat-rclone/pkg/rclone"
+)
+
+// maxDone is how many finished items are kept for display.
+const maxDone = 20
+
+// Priorities offered by the UI. Any int works; higher runs first.
+const (
+	Low    = -10
+	Normal = 0
+	High   = 10
+)
+
+// Item is a transfer owned by the queue.
+type Item struct {
+	ID        int64
+	Transfer  rclone.Transfer
+	Priority  int
+	Source    string // who submitted it, e.g. "task:nightly"
+	Status    string // queued, running, finished, error or cancelled
+	Enqueued  time.Time
+	Started   time.Time
+	Finished  time.Time
+	JobID     int64
+	ExecuteID string
+	Error     string
+}
+
+// Remotes returns the remotes the item's transfer uses.
+func (it *Item) Remotes() []string {
+	if it.Transfer.SrcRemote == it.Transfer.DstRemote {
+		return []string{it.Transfer.SrcRemote}
+	}
+	return []string{it.Transfer.SrcRemote, it.Transfer.DstRemote}
+}
+
+// Queue launches transfers in priority order, keeping at most MaxRunning
+// jobs running overall and at most MaxPerRemote touching any one remote.
+// Zero means no limit.
+type Queue struct {
+	rc           *rclone.Client
+	MaxRunning   int
+	MaxPerRemote int
+
+	// OnStart, if set, is called after an item's job has been launched.
+	OnStart func(jobID int64, t rclone.Transfer)
+
+	// mu guards the lists and items. It is never held while calling
+	// rclone or OnStart, so a slow remote cannot stall the queue's readers.
+	mu      sync.Mutex
+	nextID  int64
+	queued  []*Item // in launch order
+	running []*Item
+	done    []*Item // most recent first
+}
+
+// New creates a queue in front of rc.
+func New(rc *rclone.Client, maxRunning, maxPerRemote int) *Queue {
+	return &Queue{rc: rc, MaxRunning: maxRunning, MaxPerRemote: maxPerRemote}
+}
+
+// Submit enqueues a transfer and starts it at once if limits allow.
+// Items are placed after every queued item of the same or higher priority.
+func (q *Queue) Submit(t rclone.Transfer, priority int, source string) Item {
+	q.mu.Lock()
+	q.nextID++
+	it := &Item{
+		ID:       q.nextID,
+		Transfer: t,
+		Priority: priority,
+		Source:   source,
+		Status:   "queued",
+		Enqueued: time.Now(),
+	}
+	pos := len(q.queued)
+	for i, other := range q.queued {
+		if other.Priority < priority {
+			pos = i
+			break
+		}
+	}
+	q.queued = slices.Insert(q.queued, pos, it)
+	starting := q.dispatch()
+	q.mu.Unlock()
+
+	q.launch(starting)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return *it
+}
+
+// Get returns a copy of the item with the given ID.
+func (q *Queue) Get(id int64) (Item, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, list := range [][]*Item{q.queued, q.running, q.done} {
+		for _, it := range list {
+			if it.ID == id {
+				return *it, true
+			}
+		}
+	}
+	return Item{}, false
+}
+
+// Snapshot returns copies of the queued, running and recently finished items.
+func (q *Queue) Snapshot() (queued, running, done []Item) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	copyItems := func(list []*Item) []Item {
+		out := make([]Item, len(list))
+		for i, it := range list {
+			out[i] = *it
+		}
+		return out
+	}
+	return copyItems(q.queued), copyItems(q.running), copyItems(q.done)
+}
+
+// Move shifts a queued item up (delta < 0) or down (delta > 0) the queue.
+// It takes the priority of the item it passes so the order it was given
+// survives later submissions.
+func (q *Queue) Move(id int64, delta int) error {
+	q.mu.Lock()
+	i := q.index(id)
+	if i < 0 {
+		q.mu.Unlock()
+		return fmt.Errorf("queue item %d is not waiting", id)
+	}
+	j := min(max(i+delta, 0), len(q.queued)-1)
+	if i == j {
+		q.mu.Unlock()
+		return nil
+	}
+	it := q.queued[i]
+	it.Priority = q.queued[j].Priority
+	q.queued = slices.Delete(q.queued, i, i+1)
+	q.queued = slices.Insert(q.queued, j, it)
+	starting := q.dispatch()
+	q.mu.Unlock()
+
+	q.launch(starting)
+	return nil
+}
+
+// Cancel removes a queued item, or stops the job of a running one.
+func (q *Queue) Cancel(id int64) error {
+	q.mu.Lock()
+	if i := q.index(id); i >= 0 {
+		it := q.queued[i]
+		q.queued = slices.Delete(q.queued, i, i+1)
+		it.Status = "cancelled"
+		it.Finished = time.Now()
+		q.finish(it)
+		q.mu.Unlock()
+		return nil
+	}
+	var jobID int64
+	found := false
+	for _, it := range q.running {
+		if it.ID == id {
+			jobID, found = it.JobID, true
+		}
+	}
+	q.mu.Unlock()
+
+	switch {
+	case !found:
+		return fmt.Errorf("queue item %d is not queued or running", id)
+	case jobID == 0:
+		return fmt.Errorf("queue item %d is still starting; try again", id)
+	}
+	return q.rc.StopJob(jobID)
+}
+
+// Run polls running jobs every interval until ctx is cancelled, releasing
+// their slots as they finish.
+func (q *Queue) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		q.Poll()
+	}
+}
+
+// Poll updates running items from rclone and starts queued ones.
+func (q *Queue) Poll() {
+	type check struct {
+		id, jobID int64
+		executeID string
+	}
+	q.mu.Lock()
+	var checks []check
+	for _, it := range q.running {
+		if it.JobID != 0 { // not still starting
+			checks = append(checks, check{it.ID, it.JobID, it.ExecuteID})
+		}
+	}
+	q.mu.Unlock()
+
+	jobs := make(map[int64]*rclone.Job, len(checks))
+	for _, c := range checks {
+		job, err := q.rc.GetJob(c.jobID)
+		if err != nil || (c.executeID != "" && job.ExecuteID != c.executeID) {
+			// Expired, or rclone restarted and the ID now means another job.
+			job = nil
+		}
+		jobs[c.id] = job
+	}
+
+	q.mu.Lock()
+	still := q.running[:0]
+	for _, it := range q.running {
+		job, checked := jobs[it.ID]
+		switch {
+		case !checked || (job != nil && !job.Finished):
+			still = append(still, it)
+			continue
+		case job == nil:
+			it.Status = "error"
+			it.Error = "job no longer reported by rclone"
+			it.Finished = time.Now()
+		case job.Success:
+			it.Status = "finished"
+			it.Finished = time.Now()
+		default:
+			it.Status = "error"
+			it.Error = job.Error
+			it.Finished = time.Now()
+		}
+		q.finish(it)
+	}
+	q.running = still
+	starting := q.dispatch()
+	q.mu.Unlock()
+
+	q.launch(starting)
+}
+
+// dispatch takes queued items, in order, while limits allow, and counts
+// them as running; launch then starts their jobs. An item blocked by its
+// remote's limit does not hold back items for other remotes. Callers must
+// hold q.mu.
+func (q *Queue) dispatch() []*Item {
+	var starting []*Item
+	for i := 0; i < len(q.queued); {
+		if q.MaxRunning > 0 && len(q.running) >= q.MaxRunning {
+			break
+		}
+		it := q.queued[i]
+		if !q.remoteFree(it) {
+			i++
+			continue
+		}
+		q.queued = slices.Delete(q.queued, i, i+1)
+		it.Status = "running"
+		it.Started = time.Now()
+		q.running = append(q.running, it)
+		starting = append(starting, it)
+	}
+	return starting
+}
+
+func (q *Queue) remoteFree(it *Item) bool {
+	if q.MaxPerRemote <= 0 {
+		return true
+	}
+	for _, remote := range it.Remotes() {
+		n := 0
+		for _, r := range q.running {
+			if slices.Contains(r.Remotes(), remote) {
+				n++
+			}
+		}
+		if n >= q.MaxPerRemote {
+			return false
+		}
+	}
+	return true
+}
+
+// launch starts the jobs of items taken by dispatch, without holding q.mu.
+// An item that fails to start frees its slot for the next in the queue.
+func (q *Queue) launch(starting []*Item) {
+	for len(starting) > 0 {
+		var failed bool
+		for _, it := range starting {
+			// The transfer never changes once queued
+			jobID, err := q.rc.StartTransfer(it.Transfer)
+			var executeID string
+			if err == nil {
+				if job, err := q.rc.GetJob(jobID); err == nil {
+					executeID = job.ExecuteID
+				}
+			}
+
+			q.mu.Lock()
+			if err != nil {
+				it.Status = "error"
+				it.Error = err.Error()
+				it.Finished = it.Started
+				q.running = slices.DeleteFunc(q.running, func(r *Item) bool { return r == it })
+				q.finish(it)
+				failed = true
+			} else {
+				it.JobID = jobID
+				it.ExecuteID = executeID
+			}
+			q.mu.Unlock()
+
+			if err != nil {
+				log.Printf("queue: item %d: %v", it.ID, err)
+			} else if q.OnStart != nil {
+				q.OnStart(jobID, it.Transfer)
+			}
+		}
+		starting = nil
+		if failed {
+			q.mu.Lock()
+			starting = q.dispatch()
+			q.mu.Unlock()
+		}
+	}
+}
+
+// finish files an item under done. Callers must hold q.mu.
+func (q *Queue) finish(it *Item) {
+	q.done = append([]*Item{it}, q.done...)
+	if len(q.done) > maxDone {
+		q.done = q.done[:maxDone]
+	}
+}
+
+func (q *Queue) index(id int64) int {
+	for i, it := range q.queued {
+		if it.ID == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -6,4 +6,5 @@ package rclone
 import (
 	_ "github.com/rclone/rclone/backend/local"
 	_ "github.com/rclone/rclone/fs/operations" // Registers operations/list, etc.
+	_ "github.com/rclone/rclone/fs/sync"       // Registers sync/copy, sync/move, etc.
 )
@@ -8,4 +8,5 @@ package rclone
 import (
 	_ "github.com/rclone/rclone/backend/all"
 	_ "github.com/rclone/rclone/fs/operations" // Registers operations/list, etc.
+	_ "github.com/rclone/rclone/fs/sync"       // Registers sync/copy, sync/move, etc.
 )
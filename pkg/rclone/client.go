@@ -5,6 +5,7 @@ package rclone
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 )
 
 // Client wraps a Backend with all the rclone business logic.
@@ -115,26 +116,68 @@ func (c *Client) DeleteRemote(name string) error {
 
 // --- Operations ---
 
-// ListItem represents a file or directory in a listing.
+// ListItem represents a file or directory in a listing. MimeType, Tier
+// and ID are only filled in where the backend has them, and Hashes only
+// when asked for.
 type ListItem struct {
-	Path    string `json:"Path"`
-	Name    string `json:"Name"`
-	Size    int64  `json:"Size"`
-	ModTime string `json:"ModTime"`
-	IsDir   bool   `json:"IsDir"`
+	Path     string            `json:"Path"`
+	Name     string            `json:"Name"`
+	Size     int64             `json:"Size"`
+	ModTime  string            `json:"ModTime"`
+	IsDir    bool              `json:"IsDir"`
+	MimeType string            `json:"MimeType,omitempty"`
+	Tier     string            `json:"Tier,omitempty"`
+	ID       string            `json:"ID,omitempty"`
+	Hashes   map[string]string `json:"Hashes,omitempty"`
 }
 
 // List lists files in a remote path.
 func (c *Client) List(remote, path string) ([]ListItem, error) {
+	return c.ListOpt(remote, path, nil)
+}
+
+// ListOpt lists files in a remote path with operations/list options,
+// such as showHash or dirsOnly.
+func (c *Client) ListOpt(remote, path string, opt map[string]any) ([]ListItem, error) {
 	fs := remote + ":"
 	if path != "" {
 		fs += path
 	}
 
-	resp, err := c.call("operations/list", map[string]any{
+	params := map[string]any{
 		"fs":     fs,
 		"remote": "",
-	})
+	}
+	if len(opt) > 0 {
+		params["opt"] = opt
+	}
+	resp, err := c.call("operations/list", params)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		List []ListItem `json:"list"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return nil, fmt.Errorf("unmarshal list: %w", err)
+	}
+	return result.List, nil
+}
+
+// ListFiles lists every file below path, recursively, keeping only those
+// the filter rules allow. filter takes the same keys as a Transfer's.
+// Item paths are relative to path.
+func (c *Client) ListFiles(remote, path string, filter map[string]any) ([]ListItem, error) {
+	params := map[string]any{
+		"fs":     remote + ":" + path,
+		"remote": "",
+		"opt":    map[string]any{"recurse": true, "filesOnly": true},
+	}
+	if len(filter) > 0 {
+		params["_filter"] = filter
+	}
+	resp, err := c.call("operations/list", params)
 	if err != nil {
 		return nil, err
 	}
@@ -175,6 +218,106 @@ func (c *Client) Purge(remote, path string) error {
 	return err
 }
 
+// Rmdir removes an empty directory.
+func (c *Client) Rmdir(remote, path string) error {
+	_, err := c.call("operations/rmdir", map[string]string{
+		"fs":     remote + ":",
+		"remote": path,
+	})
+	return err
+}
+
+// Rmdirs removes every empty directory under path, and path itself
+// unless leaveRoot is set.
+func (c *Client) Rmdirs(remote, path string, leaveRoot bool) error {
+	_, err := c.call("operations/rmdirs", map[string]any{
+		"fs":        remote + ":",
+		"remote":    path,
+		"leaveRoot": leaveRoot,
+	})
+	return err
+}
+
+// MoveFile moves a single file, server-side where the backend allows it.
+func (c *Client) MoveFile(srcRemote, srcPath, dstRemote, dstPath string) error {
+	_, err := c.call("operations/movefile", map[string]string{
+		"srcFs":     srcRemote + ":",
+		"srcRemote": srcPath,
+		"dstFs":     dstRemote + ":",
+		"dstRemote": dstPath,
+	})
+	return err
+}
+
+// MoveDir moves a directory tree and removes the emptied source directories.
+func (c *Client) MoveDir(srcRemote, srcPath, dstRemote, dstPath string) error {
+	_, err := c.call("sync/move", map[string]any{
+		"srcFs":              srcRemote + ":" + srcPath,
+		"dstFs":              dstRemote + ":" + dstPath,
+		"deleteEmptySrcDirs": true,
+	})
+	return err
+}
+
+// Stat returns the item at path, or nil if there is nothing there.
+func (c *Client) Stat(remote, path string) (*ListItem, error) {
+	resp, err := c.call("operations/stat", map[string]string{
+		"fs":     remote + ":",
+		"remote": path,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Item *ListItem `json:"item"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return nil, fmt.Errorf("unmarshal stat: %w", err)
+	}
+	return result.Item, nil
+}
+
+// Hashes returns the hashes of the file at path. Backends that do not
+// store hashes, such as local disks, compute them by reading the file.
+func (c *Client) Hashes(remote, path string) (map[string]string, error) {
+	resp, err := c.call("operations/stat", map[string]any{
+		"fs":     remote + ":",
+		"remote": path,
+		"opt":    map[string]any{"showHash": true},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Item *ListItem `json:"item"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return nil, fmt.Errorf("unmarshal stat: %w", err)
+	}
+	if result.Item == nil {
+		return nil, fmt.Errorf("%s:%s not found", remote, path)
+	}
+	return result.Item.Hashes, nil
+}
+
+// Size returns the number of files under path and their total size.
+func (c *Client) Size(remote, path string) (count, bytes int64, err error) {
+	resp, err := c.call("operations/size", map[string]string{
+		"fs": remote + ":" + path,
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	var result struct {
+		Count int64 `json:"count"`
+		Bytes int64 `json:"bytes"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return 0, 0, fmt.Errorf("unmarshal size: %w", err)
+	}
+	return result.Count, result.Bytes, nil
+}
+
 // --- Core Operations ---
 
 // Version returns rclone version info.
@@ -205,6 +348,24 @@ func (c *Client) Stats() (map[string]any, error) {
 	return result, nil
 }
 
+// GroupStats returns transfer statistics for a single stats group.
+// Every job is accounted under its group ("job/N" unless _group was set).
+func (c *Client) GroupStats(group string) (map[string]any, error) {
+	resp, err := c.call("core/stats", map[string]any{
+		"group": group,
+		"short": true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result map[string]any
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return nil, fmt.Errorf("unmarshal stats: %w", err)
+	}
+	return result, nil
+}
+
 // --- Sync/Copy Operations ---
 
 // Copy copies files from source to destination.
@@ -225,17 +386,94 @@ func (c *Client) Move(srcRemote, srcPath, dstRemote, dstPath string) error {
 	return err
 }
 
+// Transfer describes a sync/copy/move between two remote paths.
+type Transfer struct {
+	Op        string         `json:"op"` // copy, sync or move
+	SrcRemote string         `json:"srcRemote"`
+	SrcPath   string         `json:"srcPath"`
+	DstRemote string         `json:"dstRemote"`
+	DstPath   string         `json:"dstPath"`
+	Group     string         `json:"group,omitempty"`  // stats group, e.g. "backup:photos"
+	Filter    map[string]any `json:"filter,omitempty"` // passed as _filter
+	Config    map[string]any `json:"config,omitempty"` // passed as _config
+
+	// DeleteEmptySrcDirs removes the source folders a move empties.
+	DeleteEmptySrcDirs bool `json:"deleteEmptySrcDirs,omitempty"`
+}
+
+// SrcFs returns the source as an rclone "remote:path" string.
+func (t Transfer) SrcFs() string {
+	return t.SrcRemote + ":" + t.SrcPath
+}
+
+// DstFs returns the destination as an rclone "remote:path" string.
+func (t Transfer) DstFs() string {
+	return t.DstRemote + ":" + t.DstPath
+}
+
+// SplitFs splits an rclone "remote:path" string into remote and path.
+func SplitFs(fs string) (remote, path string, err error) {
+	remote, path, ok := strings.Cut(fs, ":")
+	if !ok || remote == "" {
+		return "", "", fmt.Errorf("%q is not of the form remote:path", fs)
+	}
+	return remote, path, nil
+}
+
+// StartTransfer starts a transfer as an async job and returns its job ID.
+// The job carries t.Group as its _group so it can be stopped with StopGroup.
+func (c *Client) StartTransfer(t Transfer) (int64, error) {
+	switch t.Op {
+	case "copy", "sync", "move":
+	default:
+		return 0, fmt.Errorf("unknown transfer op %q", t.Op)
+	}
+
+	params := map[string]any{
+		"srcFs":  t.SrcFs(),
+		"dstFs":  t.DstFs(),
+		"_async": true,
+	}
+	if t.Group != "" {
+		params["_group"] = t.Group
+	}
+	if len(t.Filter) > 0 {
+		params["_filter"] = t.Filter
+	}
+	if len(t.Config) > 0 {
+		params["_config"] = t.Config
+	}
+	if t.Op == "move" && t.DeleteEmptySrcDirs {
+		params["deleteEmptySrcDirs"] = true
+	}
+
+	resp, err := c.call("sync/"+t.Op, params)
+	if err != nil {
+		return 0, err
+	}
+
+	var result struct {
+		JobID int64 `json:"jobid"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return 0, fmt.Errorf("unmarshal job id: %w", err)
+	}
+	return result.JobID, nil
+}
+
 // --- Job Operations ---
 
 // Job represents an rclone job.
 type Job struct {
-	ID        int64  `json:"id"`
-	Group     string `json:"group"`
-	StartTime string `json:"startTime"`
-	EndTime   string `json:"endTime,omitempty"`
-	Error     string `json:"error,omitempty"`
-	Finished  bool   `json:"finished"`
-	Success   bool   `json:"success"`
+	ID        int64   `json:"id"`
+	ExecuteID string  `json:"executeId"` // changes when rclone restarts
+	Group     string  `json:"group"`
+	StartTime string  `json:"startTime"`
+	EndTime   string  `json:"endTime,omitempty"`
+	Error     string  `json:"error,omitempty"`
+	Finished  bool    `json:"finished"`
+	Success   bool    `json:"success"`
+	Duration  float64 `json:"duration"` // seconds, set once finished
 }
 
 // ListJobs returns all current jobs.
@@ -283,3 +521,9 @@ func (c *Client) StopJob(id int64) error {
 	_, err := c.call("job/stop", map[string]int64{"jobid": id})
 	return err
 }
+
+// StopGroup stops all running jobs in a group.
+func (c *Client) StopGroup(group string) error {
+	_, err := c.call("job/stopgroup", map[string]string{"group": group})
+	return err
+}
@@ -0,0 +1,250 @@
+package rclone
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/librclone/librclone"
+)
+
+// ListStream lists remote:path like ListOpt, but hands each entry to fn as
+// it arrives instead of collecting them, so a folder of any size lists in
+// constant memory. opt takes the operations/list options and filter the
+// same keys as a Transfer's. Listing stops at the first error fn returns,
+// or when ctx is cancelled.
+//
+// Over HTTP the response is decoded entry by entry as it is read. The
+// embedded backend walks the remote through the rclone fs layer, so
+// entries reach fn while the listing is still running.
+func (c *Client) ListStream(ctx context.Context, remote, path string, opt, filter map[string]any, fn func(ListItem) error) error {
+	params := map[string]any{
+		"fs":     remote + ":" + path,
+		"remote": "",
+	}
+	if len(opt) > 0 {
+		params["opt"] = opt
+	}
+	if len(filter) > 0 {
+		params["_filter"] = filter
+	}
+	switch b := c.backend.(type) {
+	case *HTTPBackend:
+		return b.listStream(ctx, params, fn)
+	case *EmbeddedBackend:
+		return b.listStream(ctx, params, fn)
+	}
+	return fmt.Errorf("streaming listings are not supported by this backend")
+}
+
+func (h *HTTPBackend) listStream(ctx context.Context, params map[string]any, fn func(ListItem) error) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("marshal params: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", h.BaseURL+"/operations/list", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.Username != "" {
+		req.SetBasicAuth(h.Username, h.Password)
+	}
+
+	resp, err := h.streamClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("rc error %d: %s", resp.StatusCode, body)
+	}
+
+	// Skip to the "list" array, then decode one entry at a time
+	dec := json.NewDecoder(resp.Body)
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("unmarshal list: %w", err)
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("unmarshal list: %w", err)
+		}
+		if key != "list" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return fmt.Errorf("unmarshal list: %w", err)
+			}
+			continue
+		}
+		if _, err := dec.Token(); err != nil {
+			return fmt.Errorf("unmarshal list: %w", err)
+		}
+		for dec.More() {
+			var item ListItem
+			if err := dec.Decode(&item); err != nil {
+				return fmt.Errorf("unmarshal list: %w", err)
+			}
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unmarshal list: no list in response")
+}
+
+func (e *EmbeddedBackend) listStream(ctx context.Context, params map[string]any, fn func(ListItem) error) error {
+	e.initOnce.Do(func() {
+		librclone.Initialize()
+	})
+	in := rc.Params(params)
+	// Apply _filter the way the RC server does for its calls
+	if rules, ok := in["_filter"].(map[string]any); ok {
+		fi, err := newFilter(ctx, rules)
+		if err != nil {
+			return err
+		}
+		ctx = filter.ReplaceConfig(ctx, fi)
+	}
+	var opt operations.ListJSONOpt
+	if err := in.GetStruct("opt", &opt); rc.NotErrParamNotFound(err) {
+		return err
+	}
+	f, remote, err := rc.GetFsAndRemote(ctx, in)
+	if err != nil {
+		return err
+	}
+	return operations.ListJSON(ctx, f, remote, &opt, func(item *operations.ListJSONItem) error {
+		var modTime string
+		if !item.ModTime.When.IsZero() {
+			modTime = item.ModTime.When.Format(item.ModTime.Format)
+		}
+		return fn(ListItem{
+			Path:     item.Path,
+			Name:     item.Name,
+			Size:     item.Size,
+			ModTime:  modTime,
+			IsDir:    item.IsDir,
+			MimeType: item.MimeType,
+			Tier:     item.Tier,
+			ID:       item.ID,
+			Hashes:   item.Hashes,
+		})
+	})
+}
+
+// Count is Size, but stops when ctx is cancelled, so a count of a large
+// remote nobody is waiting for does not run on. filter takes the same
+// keys as a Transfer's.
+func (c *Client) Count(ctx context.Context, remote, path string, filter map[string]any) (count, bytes int64, err error) {
+	params := map[string]any{"fs": remote + ":" + path}
+	if len(filter) > 0 {
+		params["_filter"] = filter
+	}
+	switch b := c.backend.(type) {
+	case *HTTPBackend:
+		return b.count(ctx, params)
+	case *EmbeddedBackend:
+		return b.count(ctx, params)
+	}
+	return 0, 0, fmt.Errorf("cancellable counts are not supported by this backend")
+}
+
+func (h *HTTPBackend) count(ctx context.Context, params map[string]any) (count, size int64, err error) {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return 0, 0, fmt.Errorf("marshal params: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", h.BaseURL+"/operations/size", bytes.NewReader(body))
+	if err != nil {
+		return 0, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.Username != "" {
+		req.SetBasicAuth(h.Username, h.Password)
+	}
+
+	resp, err := h.streamClient().Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return 0, 0, fmt.Errorf("rc error %d: %s", resp.StatusCode, body)
+	}
+	var result struct {
+		Count int64 `json:"count"`
+		Bytes int64 `json:"bytes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, 0, fmt.Errorf("unmarshal size: %w", err)
+	}
+	return result.Count, result.Bytes, nil
+}
+
+func (e *EmbeddedBackend) count(ctx context.Context, params map[string]any) (count, size int64, err error) {
+	e.initOnce.Do(func() {
+		librclone.Initialize()
+	})
+	if rules, ok := params["_filter"].(map[string]any); ok {
+		fi, err := newFilter(ctx, rules)
+		if err != nil {
+			return 0, 0, err
+		}
+		ctx = filter.ReplaceConfig(ctx, fi)
+	}
+	f, err := cache.Get(ctx, params["fs"].(string))
+	if err != nil {
+		return 0, 0, err
+	}
+	count, size, _, err = operations.Count(ctx, f)
+	return count, size, err
+}
+
+// CheckFilter reports whether rclone accepts filter, which takes the same
+// keys as a Transfer's, so bad rules or sizes are caught before anything
+// is listed.
+func CheckFilter(filter map[string]any) error {
+	_, err := newFilter(context.Background(), filter)
+	return err
+}
+
+// newFilter builds filter on top of the filter options in ctx.
+func newFilter(ctx context.Context, rules map[string]any) (*filter.Filter, error) {
+	opt := filter.GetConfig(ctx).Opt
+	if err := rc.Params(map[string]any{"_filter": rules}).GetStruct("_filter", &opt); err != nil {
+		return nil, err
+	}
+	return filter.NewFilter(&opt)
+}
+
+// NameRules are include rules for exactly the named files and folders at
+// the root of a listing or transfer, folders with everything in them.
+func NameRules(names []string) []string {
+	rules := make([]string, 0, 2*len(names))
+	for _, name := range names {
+		name = globEscaper.Replace(name)
+		rules = append(rules, "/"+name, "/"+name+"/**")
+	}
+	return rules
+}
+
+// DirRule is a rule for the folder at path, relative to the root of a
+// listing or transfer, and everything in it.
+func DirRule(path string) string {
+	return "/" + globEscaper.Replace(strings.Trim(path, "/")) + "/**"
+}
+
+// globEscaper makes a name match itself in an rclone glob.
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`, `{`, `\{`, `}`, `\}`)
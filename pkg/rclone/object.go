@@ -0,0 +1,240 @@
+package rclone
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/lib/http/serve"
+	"github.com/rclone/rclone/librclone/librclone"
+)
+
+// Headers copied from the browser's request to rcd, and from its response back.
+var (
+	proxiedRequestHeaders  = []string{"Range", "If-Range", "If-Modified-Since", "If-None-Match"}
+	proxiedResponseHeaders = []string{
+		"Accept-Ranges", "Content-Type", "Content-Length", "Content-Range",
+		"Content-Disposition", "Content-Encoding", "Last-Modified", "ETag", "Cache-Control",
+	}
+)
+
+// ServeFile writes the content of the file at remote:path to w, with
+// Content-Type, Content-Length, Last-Modified and HTTP Range support, so
+// large files can be streamed and resumed.
+//
+// Over HTTP the request is proxied to the object URLs rcd serves when
+// started with --rc-serve. The embedded backend opens the object through
+// the rclone fs layer. An error is returned only if nothing was written,
+// leaving the caller to report it.
+func (c *Client) ServeFile(w http.ResponseWriter, r *http.Request, remote, path string) error {
+	switch b := c.backend.(type) {
+	case *HTTPBackend:
+		return b.serveFile(w, r, remote, path)
+	case *EmbeddedBackend:
+		return b.serveFile(w, r, remote, path)
+	}
+	return fmt.Errorf("downloads are not supported by this backend")
+}
+
+// OpenFile opens the file at remote:path for reading.
+func (c *Client) OpenFile(ctx context.Context, remote, path string) (io.ReadCloser, error) {
+	return c.openRange(ctx, remote, path, -1)
+}
+
+// ReadPrefix reads at most n bytes from the start of the file at
+// remote:path, and reports whether the file is longer than that. Only the
+// prefix is fetched from the remote.
+func (c *Client) ReadPrefix(ctx context.Context, remote, path string, n int64) ([]byte, bool, error) {
+	in, err := c.openRange(ctx, remote, path, n+1)
+	if err != nil {
+		return nil, false, err
+	}
+	defer in.Close()
+	data, err := io.ReadAll(io.LimitReader(in, n+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(data)) > n {
+		return data[:n], true, nil
+	}
+	return data, false, nil
+}
+
+// openRange opens the first count bytes of remote:path, or all of it if
+// count is negative.
+func (c *Client) openRange(ctx context.Context, remote, path string, count int64) (io.ReadCloser, error) {
+	switch b := c.backend.(type) {
+	case *HTTPBackend:
+		return b.openRange(ctx, remote, path, count)
+	case *EmbeddedBackend:
+		return b.openRange(ctx, remote, path, count)
+	}
+	return nil, fmt.Errorf("downloads are not supported by this backend")
+}
+
+// objectURL returns the --rc-serve URL of remote:path.
+func (h *HTTPBackend) objectURL(remote, path string) (string, error) {
+	u, err := url.Parse(h.BaseURL)
+	if err != nil {
+		return "", err
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + "/[" + remote + ":]/" + strings.TrimLeft(path, "/")
+	return u.String(), nil
+}
+
+// objectRequest builds a request for remote:path with the backend's auth.
+func (h *HTTPBackend) objectRequest(ctx context.Context, method, remote, path string) (*http.Request, error) {
+	u, err := h.objectURL(remote, path)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Pass bytes through untouched so lengths and ranges stay valid
+	req.Header.Set("Accept-Encoding", "identity")
+	if h.Username != "" {
+		req.SetBasicAuth(h.Username, h.Password)
+	}
+	return req, nil
+}
+
+// objectError turns a failed --rc-serve response into an error.
+func objectError(resp *http.Response) error {
+	// Without --rc-serve rcd answers object URLs with a plain-text 404
+	if resp.StatusCode == http.StatusNotFound && !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return fmt.Errorf("rcd does not serve files; start it with --rc-serve to enable downloads")
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return fmt.Errorf("rc error %d: %s", resp.StatusCode, body)
+}
+
+func (h *HTTPBackend) openRange(ctx context.Context, remote, path string, count int64) (io.ReadCloser, error) {
+	req, err := h.objectRequest(ctx, "GET", remote, path)
+	if err != nil {
+		return nil, err
+	}
+	if count >= 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", count-1))
+	}
+	resp, err := h.streamClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+		return resp.Body, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		// An empty file has no first byte
+		resp.Body.Close()
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	defer resp.Body.Close()
+	return nil, objectError(resp)
+}
+
+func (e *EmbeddedBackend) openRange(ctx context.Context, remote, path string, count int64) (io.ReadCloser, error) {
+	o, err := e.object(ctx, remote, path)
+	if err != nil {
+		return nil, err
+	}
+	if count >= 0 {
+		return o.Open(ctx, &fs.RangeOption{Start: 0, End: count - 1})
+	}
+	return o.Open(ctx)
+}
+
+func (h *HTTPBackend) serveFile(w http.ResponseWriter, r *http.Request, remote, path string) error {
+	req, err := h.objectRequest(r.Context(), r.Method, remote, path)
+	if err != nil {
+		return err
+	}
+	for _, name := range proxiedRequestHeaders {
+		if v := r.Header.Get(name); v != "" {
+			req.Header.Set(name, v)
+		}
+	}
+
+	resp, err := h.streamClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 && resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		return objectError(resp)
+	}
+	if size, ok := pastEnd(resp.Header.Get("Content-Range")); ok && resp.StatusCode == http.StatusPartialContent {
+		w.Header().Set("Content-Range", "bytes */"+size)
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return nil
+	}
+
+	for _, name := range proxiedResponseHeaders {
+		if v := resp.Header.Get(name); v != "" {
+			w.Header().Set(name, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+	return nil
+}
+
+func (e *EmbeddedBackend) serveFile(w http.ResponseWriter, r *http.Request, remote, path string) error {
+	o, err := e.object(r.Context(), remote, path)
+	if err != nil {
+		return err
+	}
+	// serve.Object answers a range past the end with a bogus 206; see pastEnd
+	if rng := r.Header.Get("Range"); rng != "" {
+		if opt, err := fs.ParseRangeOption(rng); err == nil {
+			if offset, _ := opt.Decode(o.Size()); o.Size() >= 0 && offset >= o.Size() {
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", o.Size()))
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				return nil
+			}
+		}
+	}
+	serve.Object(w, r, o)
+	return nil
+}
+
+// object looks up the file at remote:path through the rclone fs layer.
+func (e *EmbeddedBackend) object(ctx context.Context, remote, path string) (fs.Object, error) {
+	e.initOnce.Do(func() {
+		librclone.Initialize()
+	})
+	f, err := cache.Get(ctx, remote+":")
+	if err != nil {
+		return nil, err
+	}
+	o, err := f.NewObject(ctx, strings.TrimLeft(path, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("%s:%s: %w", remote, path, err)
+	}
+	return o, nil
+}
+
+// pastEnd reports whether a Content-Range header describes a range that
+// starts beyond its end, which rclone sends for ranges past the end of the
+// file instead of a 416. It returns the complete length.
+func pastEnd(contentRange string) (size string, ok bool) {
+	var start, end int64
+	if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/%s", &start, &end, &size); err != nil {
+		return "", false
+	}
+	return size, start > end
+}
+
+// streamClient returns a client for transfers that take as long as they
+// take; the RC call timeout does not apply to them.
+func (h *HTTPBackend) streamClient() *http.Client {
+	client := *h.HTTPClient
+	client.Timeout = 0
+	return &client
+}
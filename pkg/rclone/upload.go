@@ -0,0 +1,82 @@
+package rclone
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/librclone/librclone"
+)
+
+// Upload streams r into a new file called name in remote:dir, replacing
+// any file of that name. Nothing is buffered to disk on this side.
+//
+// Over HTTP the data goes to operations/uploadfile as a multipart request.
+// That call needs the raw HTTP request, which librclone cannot provide, so
+// the embedded backend writes through the rclone fs layer instead.
+func (c *Client) Upload(ctx context.Context, remote, dir, name string, r io.Reader) error {
+	fsString := remote + ":" + dir
+	switch b := c.backend.(type) {
+	case *HTTPBackend:
+		return b.upload(ctx, fsString, name, r)
+	case *EmbeddedBackend:
+		return b.upload(ctx, fsString, name, r)
+	}
+	return fmt.Errorf("upload is not supported by this backend")
+}
+
+func (h *HTTPBackend) upload(ctx context.Context, fsString, name string, r io.Reader) error {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		part, err := mw.CreateFormFile("file", name)
+		if err == nil {
+			_, err = io.Copy(part, r)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	query := url.Values{"fs": {fsString}, "remote": {""}}
+	req, err := http.NewRequestWithContext(ctx, "POST", h.BaseURL+"/operations/uploadfile?"+query.Encode(), pr)
+	if err != nil {
+		pr.CloseWithError(err)
+		return err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	if h.Username != "" {
+		req.SetBasicAuth(h.Username, h.Password)
+	}
+
+	resp, err := h.streamClient().Do(req)
+	if err != nil {
+		pr.CloseWithError(err)
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("rc error %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+func (e *EmbeddedBackend) upload(ctx context.Context, fsString, name string, r io.Reader) error {
+	e.initOnce.Do(func() {
+		librclone.Initialize()
+	})
+	f, err := cache.Get(ctx, fsString)
+	if err != nil {
+		return err
+	}
+	_, err = operations.Rcat(ctx, f, name, io.NopCloser(r), time.Now(), nil)
+	return err
+}
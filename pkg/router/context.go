@@ -3,6 +3,7 @@ package router
 import (
 	"encoding/json"
 	"net/http"
+	"net/url"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/joeblew999/plat-rclone/pkg/datastar"
@@ -20,9 +21,16 @@ func NewContext(w http.ResponseWriter, r *http.Request) *Context {
 	return &Context{Request: r, Response: w}
 }
 
-// Param returns a URL path parameter.
+// Param returns a URL path parameter, unescaped. chi matches against the
+// raw path when the request has one, leaving its parameters escaped.
 func (c *Context) Param(key string) string {
-	return chi.URLParam(c.Request, key)
+	v := chi.URLParam(c.Request, key)
+	if c.Request.URL.RawPath != "" {
+		if unescaped, err := url.PathUnescape(v); err == nil {
+			return unescaped
+		}
+	}
+	return v
 }
 
 // Query returns a query string parameter.
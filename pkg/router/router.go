@@ -8,9 +8,11 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 )
 
-// Router wraps chi.Mux with convenience methods.
+// Router wraps chi.Mux with convenience methods. Responses of the routes
+// it adds are compressed; those added on Mux directly are not.
 type Router struct {
 	*chi.Mux
+	compressed chi.Router
 }
 
 // New creates a new Router with default middleware.
@@ -18,8 +20,14 @@ func New() *Router {
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.Compress(5))
-	return &Router{Mux: r}
+	return &Router{Mux: r, compressed: r.With(middleware.Compress(5))}
+}
+
+// Download registers a handler for GET requests that sends a file or
+// archive itself. Its response is left uncompressed, as compressing it
+// would break the lengths and byte ranges it sets.
+func (r *Router) Download(pattern string, h http.HandlerFunc) {
+	r.Mux.Get(pattern, h)
 }
 
 // Handler is a function that handles requests with a Context.
@@ -30,33 +38,36 @@ type PageHandler func(*Context) (string, error)
 
 // GET registers a Datastar SSE handler for GET requests.
 func (r *Router) GET(pattern string, h Handler) {
-	r.Mux.Get(pattern, r.wrap(h))
+	r.compressed.Get(pattern, r.wrap(h))
 }
 
 // POST registers a Datastar SSE handler for POST requests.
 func (r *Router) POST(pattern string, h Handler) {
-	r.Mux.Post(pattern, r.wrap(h))
+	r.compressed.Post(pattern, r.wrap(h))
 }
 
 // PUT registers a Datastar SSE handler for PUT requests.
 func (r *Router) PUT(pattern string, h Handler) {
-	r.Mux.Put(pattern, r.wrap(h))
+	r.compressed.Put(pattern, r.wrap(h))
 }
 
 // DELETE registers a Datastar SSE handler for DELETE requests.
 func (r *Router) DELETE(pattern string, h Handler) {
-	r.Mux.Delete(pattern, r.wrap(h))
+	r.compressed.Delete(pattern, r.wrap(h))
 }
 
 // Page registers a handler that returns full HTML pages.
 func (r *Router) Page(pattern string, h PageHandler) {
-	r.Mux.Get(pattern, func(w http.ResponseWriter, req *http.Request) {
+	r.compressed.Get(pattern, func(w http.ResponseWriter, req *http.Request) {
 		ctx := NewContext(w, req)
 		html, err := h(ctx)
 		if err != nil {
 			ctx.Error(err)
 			return
 		}
+		if ctx.written {
+			return // the handler redirected or responded itself
+		}
 		ctx.HTML(html)
 	})
 }
@@ -64,7 +75,7 @@ func (r *Router) Page(pattern string, h PageHandler) {
 // Static serves static files from a directory.
 func (r *Router) Static(pattern, dir string) {
 	fs := http.FileServer(http.Dir(dir))
-	r.Mux.Handle(pattern+"*", http.StripPrefix(pattern, fs))
+	r.compressed.Handle(pattern+"*", http.StripPrefix(pattern, fs))
 }
 
 func (r *Router) wrap(h Handler) http.HandlerFunc {
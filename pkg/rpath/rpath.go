@@ -0,0 +1,101 @@
+// Package rpath is the one place paths on remotes are cleaned, joined and
+// put into URLs. File names may hold anything a remote allows: spaces,
+// quotes, "&", "#", "?", "+", "%" and any Unicode. Templates build every
+// link and Datastar action with these helpers, and handlers clean what
+// they receive with Clean, so a name survives the round trip unchanged.
+//
+// Paths are relative to the remote's root and have no leading or trailing
+// slash; the root itself is "".
+package rpath
+
+import (
+	"encoding/json"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Clean resolves p to a path relative to the remote's root. Empty
+// elements and "." are dropped, and ".." never climbs above the root.
+func Clean(p string) string {
+	return strings.Trim(path.Clean("/"+p), "/")
+}
+
+// Join returns the path of name inside dir.
+func Join(dir, name string) string {
+	return Clean(dir + "/" + name)
+}
+
+// Parent returns the folder holding p, "" for the root and its entries.
+func Parent(p string) string {
+	p = Clean(p)
+	if i := strings.LastIndex(p, "/"); i >= 0 {
+		return p[:i]
+	}
+	return ""
+}
+
+// Base returns the last element of p, or "" for the root.
+func Base(p string) string {
+	p = Clean(p)
+	return p[strings.LastIndex(p, "/")+1:]
+}
+
+// Elems splits p into its names.
+func Elems(p string) []string {
+	p = Clean(p)
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+// URL fills the {remote} placeholder of a route with the escaped remote
+// name and adds p as the path query parameter, as handlers expect:
+//
+//	URL("/api/files/{remote}/mkdir", "s3", "a b/c&d") == "/api/files/s3/mkdir?path=a+b%2Fc%26d"
+func URL(route, remote, p string) string {
+	return strings.Replace(route, "{remote}", url.PathEscape(remote), 1) + "?path=" + url.QueryEscape(Clean(p))
+}
+
+// Browse returns the bookmarkable page of the folder p on remote, with
+// each name escaped on its own.
+func Browse(remote, p string) string {
+	u := "/browse/" + url.PathEscape(remote) + "/"
+	for i, name := range Elems(p) {
+		if i > 0 {
+			u += "/"
+		}
+		u += url.PathEscape(name)
+	}
+	return u
+}
+
+// ParseBrowse splits the escaped path of a Browse URL back into the
+// remote and folder.
+func ParseBrowse(escaped string) (remote, p string, ok bool) {
+	rest, found := strings.CutPrefix(escaped, "/browse/")
+	if !found {
+		return "", "", false
+	}
+	names := strings.Split(rest, "/")
+	for i, elem := range names {
+		name, err := url.PathUnescape(elem)
+		if err != nil {
+			return "", "", false
+		}
+		names[i] = name
+	}
+	if names[0] == "" {
+		return "", "", false
+	}
+	return names[0], Clean(strings.Join(names[1:], "/")), true
+}
+
+// JS quotes s as a JavaScript string literal, for URLs and names put in
+// Datastar expressions. $ is escaped, or Datastar would take a name such
+// as $RECYCLE.BIN for a signal.
+func JS(s string) string {
+	b, _ := json.Marshal(s)
+	return strings.ReplaceAll(string(b), "$", `\u0024`)
+}
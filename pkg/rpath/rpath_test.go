@@ -0,0 +1,167 @@
+package rpath
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// hostile are names a remote may hold that break naive URL or string
+// building.
+var hostile = []string{
+	"plain",
+	"a b",
+	"a&b=c",
+	"#hash",
+	"what?",
+	"it's",
+	`say "hi"`,
+	"1+1",
+	"100%",
+	"%2F",
+	"$RECYCLE.BIN",
+	"${x}",
+	"back\\slash",
+	"</script>",
+	"naïve café",
+	"日本語",
+	"emoji 🎉",
+	"tab\there",
+}
+
+func TestClean(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"", ""},
+		{"/", ""},
+		{".", ""},
+		{"a", "a"},
+		{"/a/b/", "a/b"},
+		{"a//b", "a/b"},
+		{"a/./b", "a/b"},
+		{"a/../b", "b"},
+		{"../../a", "a"},
+		{"/..", ""},
+		{"a b/c&d", "a b/c&d"},
+		{"it's/\"q\"", "it's/\"q\""},
+		{"$RECYCLE.BIN/x", "$RECYCLE.BIN/x"},
+		{"日本/語", "日本/語"},
+	}
+	for _, tt := range tests {
+		if got := Clean(tt.in); got != tt.want {
+			t.Errorf("Clean(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	tests := []struct{ dir, name, want string }{
+		{"", "a", "a"},
+		{"a", "b", "a/b"},
+		{"a/", "/b", "a/b"},
+		{"a", "..", ""},
+		{"a/b", "../c", "a/c"},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		if got := Join(tt.dir, tt.name); got != tt.want {
+			t.Errorf("Join(%q, %q) = %q, want %q", tt.dir, tt.name, got, tt.want)
+		}
+	}
+	for _, name := range hostile {
+		if got := Join("dir", name); got != "dir/"+name {
+			t.Errorf("Join(dir, %q) = %q", name, got)
+		}
+	}
+}
+
+func TestParentBase(t *testing.T) {
+	tests := []struct{ in, parent, base string }{
+		{"", "", ""},
+		{"a", "", "a"},
+		{"a/b", "a", "b"},
+		{"/a/b/c/", "a/b", "c"},
+		{"x/a&b#c?d", "x", "a&b#c?d"},
+		{"日本/語", "日本", "語"},
+	}
+	for _, tt := range tests {
+		if got := Parent(tt.in); got != tt.parent {
+			t.Errorf("Parent(%q) = %q, want %q", tt.in, got, tt.parent)
+		}
+		if got := Base(tt.in); got != tt.base {
+			t.Errorf("Base(%q) = %q, want %q", tt.in, got, tt.base)
+		}
+	}
+}
+
+func TestURL(t *testing.T) {
+	if got, want := URL("/api/files/{remote}/mkdir", "s3", "a b/c&d"), "/api/files/s3/mkdir?path=a+b%2Fc%26d"; got != want {
+		t.Errorf("URL = %q, want %q", got, want)
+	}
+	for _, remote := range []string{"s3", "my remote", "a&b", "r#1", "日本"} {
+		for _, name := range hostile {
+			p := "dir/" + name
+			u, err := url.Parse(URL("/api/files/{remote}", remote, p))
+			if err != nil {
+				t.Fatalf("URL(%q, %q): %v", remote, p, err)
+			}
+			if got := strings.TrimPrefix(u.Path, "/api/files/"); got != remote {
+				t.Errorf("URL(%q, %q) remote = %q", remote, p, got)
+			}
+			if got := u.Query().Get("path"); got != p {
+				t.Errorf("URL(%q, %q) path = %q", remote, p, got)
+			}
+			if len(u.Query()) != 1 {
+				t.Errorf("URL(%q, %q) query = %v, want only path", remote, p, u.Query())
+			}
+		}
+	}
+}
+
+func TestBrowseRoundTrip(t *testing.T) {
+	for _, remote := range []string{"s3", "my remote", "a&b", "r#1", "100%", "日本"} {
+		for _, name := range hostile {
+			for _, p := range []string{"", name, name + "/sub", "top/" + name} {
+				u := Browse(remote, p)
+				parsed, err := url.Parse(u)
+				if err != nil {
+					t.Fatalf("Browse(%q, %q) = %q: %v", remote, p, u, err)
+				}
+				if parsed.RawQuery != "" || parsed.Fragment != "" {
+					t.Errorf("Browse(%q, %q) = %q leaks into the query or fragment", remote, p, u)
+				}
+				gotRemote, gotPath, ok := ParseBrowse(parsed.EscapedPath())
+				if !ok || gotRemote != remote || gotPath != p {
+					t.Errorf("ParseBrowse(Browse(%q, %q)) = %q, %q, %v", remote, p, gotRemote, gotPath, ok)
+				}
+			}
+		}
+	}
+}
+
+func TestParseBrowseRejects(t *testing.T) {
+	for _, escaped := range []string{"", "/", "/browse/", "/files/s3/a", "/browse/s3/%zz"} {
+		if remote, p, ok := ParseBrowse(escaped); ok {
+			t.Errorf("ParseBrowse(%q) = %q, %q, true; want not ok", escaped, remote, p)
+		}
+	}
+}
+
+func TestJS(t *testing.T) {
+	for _, s := range append(hostile, "", "a'b\"c", " ", "a\nb") {
+		quoted := JS(s)
+		if strings.Contains(quoted, "$") {
+			t.Errorf("JS(%q) = %s holds a $, which Datastar reads as a signal", s, quoted)
+		}
+		if strings.ContainsAny(quoted, "\n\r") {
+			t.Errorf("JS(%q) = %s holds a line break", s, quoted)
+		}
+		var back string
+		if err := json.Unmarshal([]byte(quoted), &back); err != nil || back != s {
+			t.Errorf("JS(%q) = %s reads back as %q, %v", s, quoted, back, err)
+		}
+	}
+	if got, want := JS("$RECYCLE.BIN"), `"\u0024RECYCLE.BIN"`; got != want {
+		t.Errorf("JS($RECYCLE.BIN) = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,505 @@
+// Package scheduler runs named copy/sync/move tasks on cron schedules.
+// Tasks and their recent outcomes are stored in an embedded bbolt database.
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/joeblew999/plat-rclone/internal/storage"
+	"github.com/joeblew999/plat-rclone/pkg/queue"
+	"github.com/joeblew999/plat-rclone/pkg/rclone"
+)
+
+// maxRuns is how many recent runs are kept per task.
+const maxRuns = 20
+
+var (
+	tasksBucket = []byte("tasks")
+	validName   = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+)
+
+// Task is a named transfer that runs on a cron schedule.
+type Task struct {
+	Name     string          `json:"name"`
+	Schedule string          `json:"schedule"` // standard 5-field cron expression or @daily etc.
+	Enabled  bool            `json:"enabled"`
+	Transfer rclone.Transfer `json:"transfer"`
+	Runs     []Run           `json:"runs,omitempty"` // most recent first
+}
+
+// Run is the outcome of one launch of a task.
+type Run struct {
+	QueueID   int64     `json:"queueId,omitempty"`
+	JobID     int64     `json:"jobId,omitempty"`
+	ExecuteID string    `json:"executeId,omitempty"`
+	Started   time.Time `json:"started"`
+	Finished  time.Time `json:"finished,omitzero"`
+	Status    string    `json:"status"` // starting, queued, running, finished, error or skipped
+	Error     string    `json:"error,omitempty"`
+	Manual    bool      `json:"manual,omitempty"`
+}
+
+// LastRun returns the most recent run, or nil if the task never ran.
+func (t *Task) LastRun() *Run {
+	if len(t.Runs) == 0 {
+		return nil
+	}
+	return &t.Runs[0]
+}
+
+// active reports whether the run is starting, waiting in the queue or
+// running.
+func (r *Run) active() bool {
+	return r.Status == "starting" || r.Status == "queued" || r.Status == "running"
+}
+
+// Group returns the stats group the task's jobs run under.
+func (t *Task) Group() string {
+	if t.Transfer.Group != "" {
+		return t.Transfer.Group
+	}
+	return "task:" + t.Name
+}
+
+// Scheduler launches tasks through an rclone Client.
+type Scheduler struct {
+	rc      *rclone.Client
+	db      *bolt.DB
+	cron    *cron.Cron
+	entries map[string]cron.EntryID
+	stop    chan struct{}
+	mu      sync.Mutex
+
+	// OnStart, if set, is called after a task's job has been launched.
+	OnStart func(jobID int64, t rclone.Transfer)
+
+	// Queue, if set, admits task runs instead of starting them directly,
+	// so they share the concurrency limits of interactive transfers.
+	// It calls its own OnStart when the job is launched.
+	Queue *queue.Queue
+}
+
+// Open opens (or creates) the task database at path.
+func Open(path string, rc *rclone.Client) (*Scheduler, error) {
+	db, err := storage.OpenBolt(path, tasksBucket)
+	if err != nil {
+		return nil, fmt.Errorf("open tasks: %w", err)
+	}
+	return &Scheduler{
+		rc:      rc,
+		db:      db,
+		cron:    cron.New(),
+		entries: make(map[string]cron.EntryID),
+		stop:    make(chan struct{}),
+	}, nil
+}
+
+// Start schedules every enabled task and begins tracking running jobs.
+func (s *Scheduler) Start() error {
+	s.mu.Lock()
+	tasks, err := s.Tasks()
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	for _, t := range tasks {
+		if s.interrupted(&t) {
+			if err := s.put(&t); err != nil {
+				log.Printf("scheduler: task %s: %v", t.Name, err)
+			}
+		}
+		if err := s.schedule(t); err != nil {
+			log.Printf("scheduler: task %s: %v", t.Name, err)
+		}
+	}
+	s.mu.Unlock()
+
+	s.cron.Start()
+	go s.poll(10 * time.Second)
+	return nil
+}
+
+// Close stops the scheduler and closes the database.
+func (s *Scheduler) Close() error {
+	close(s.stop)
+	<-s.cron.Stop().Done()
+	return s.db.Close()
+}
+
+// Tasks returns all tasks sorted by name.
+func (s *Scheduler) Tasks() ([]Task, error) {
+	var tasks []Task
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(tasksBucket).ForEach(func(k, v []byte) error {
+			var t Task
+			if err := json.Unmarshal(v, &t); err != nil {
+				return fmt.Errorf("unmarshal task %s: %w", k, err)
+			}
+			tasks = append(tasks, t)
+			return nil
+		})
+	})
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].Name < tasks[j].Name
+	})
+	return tasks, err
+}
+
+// Get returns the named task.
+func (s *Scheduler) Get(name string) (*Task, error) {
+	var t *Task
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(tasksBucket).Get([]byte(name))
+		if data == nil {
+			return fmt.Errorf("task %q not found", name)
+		}
+		t = new(Task)
+		return json.Unmarshal(data, t)
+	})
+	return t, err
+}
+
+// Next returns when the named task will next run, or the zero time
+// if it is disabled.
+func (s *Scheduler) Next(name string) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.entries[name]
+	if !ok {
+		return time.Time{}
+	}
+	return s.cron.Entry(id).Next
+}
+
+// Save creates or updates a task. Existing run history is preserved.
+func (s *Scheduler) Save(t Task) error {
+	if !validName.MatchString(t.Name) {
+		return fmt.Errorf("task name must only contain letters, digits, '.', '_' or '-'")
+	}
+	if _, err := cron.ParseStandard(t.Schedule); err != nil {
+		return fmt.Errorf("invalid schedule %q: %w", t.Schedule, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if old, err := s.Get(t.Name); err == nil {
+		t.Runs = old.Runs
+	}
+	if err := s.put(&t); err != nil {
+		return err
+	}
+	return s.schedule(t)
+}
+
+// Delete removes a task.
+func (s *Scheduler) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.unschedule(name)
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(tasksBucket).Delete([]byte(name))
+	})
+}
+
+// SetEnabled enables or disables a task's schedule.
+func (s *Scheduler) SetEnabled(name string, enabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.Get(name)
+	if err != nil {
+		return err
+	}
+	t.Enabled = enabled
+	if err := s.put(t); err != nil {
+		return err
+	}
+	return s.schedule(*t)
+}
+
+// RunNow launches a task immediately, regardless of its schedule.
+func (s *Scheduler) RunNow(name string) (Run, error) {
+	return s.run(name, true)
+}
+
+// run launches a task unless its previous run is still going. The run
+// is recorded as starting while rclone is called, without s.mu, so a slow
+// rclone does not hold up the other tasks or stop a second launch seeing it.
+func (s *Scheduler) run(name string, manual bool) (Run, error) {
+	s.mu.Lock()
+	t, err := s.Get(name)
+	s.mu.Unlock()
+	if err != nil {
+		return Run{}, err
+	}
+	jobs := s.jobs(t)
+
+	s.mu.Lock()
+	t, err = s.Get(name)
+	if err != nil {
+		s.mu.Unlock()
+		return Run{}, err
+	}
+	s.refresh(t, jobs)
+	run := Run{Started: time.Now(), Manual: manual, Status: "starting"}
+	if last := t.LastRun(); last != nil && last.active() {
+		run.Status = "skipped"
+		run.Error = "previous run still " + last.Status
+	}
+	s.record(t, run)
+	err = s.put(t)
+	s.mu.Unlock()
+	if err != nil || run.Status == "skipped" {
+		return run, err
+	}
+
+	tr := t.Transfer
+	tr.Group = t.Group()
+	if s.Queue != nil {
+		item := s.Queue.Submit(tr, queue.Normal, "task:"+t.Name)
+		run.QueueID = item.ID
+		run.Status = "queued"
+	} else if jobID, err := s.rc.StartTransfer(tr); err != nil {
+		run.Status = "error"
+		run.Error = err.Error()
+	} else {
+		run.JobID = jobID
+		run.Status = "running"
+		if job, err := s.rc.GetJob(jobID); err == nil {
+			run.ExecuteID = job.ExecuteID
+		}
+		if s.OnStart != nil {
+			s.OnStart(jobID, tr)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err = s.Get(name)
+	if err != nil {
+		// Deleted while starting; the job runs on regardless
+		return run, nil
+	}
+	for i := range t.Runs {
+		if t.Runs[i].Status == "starting" && t.Runs[i].Started.Equal(run.Started) {
+			t.Runs[i] = run
+			if run.Status == "queued" {
+				s.refreshQueued(&t.Runs[i], t.Name)
+			}
+			run = t.Runs[i]
+		}
+	}
+	return run, s.put(t)
+}
+
+// record adds run as the task's most recent.
+func (s *Scheduler) record(t *Task, run Run) {
+	t.Runs = append([]Run{run}, t.Runs...)
+	if len(t.Runs) > maxRuns {
+		t.Runs = t.Runs[:maxRuns]
+	}
+}
+
+// interrupted fails runs left starting by a previous process, which
+// stopped before it recorded their launch. It reports whether t changed.
+func (s *Scheduler) interrupted(t *Task) bool {
+	changed := false
+	for i := range t.Runs {
+		if run := &t.Runs[i]; run.Status == "starting" {
+			run.Status = "error"
+			run.Error = "interrupted while starting"
+			run.Finished = run.Started
+			changed = true
+		}
+	}
+	return changed
+}
+
+// poll periodically records the outcome of running jobs. Each task is
+// read again once rclone has answered, so runs started, edits saved and
+// tasks deleted in the meantime are kept.
+func (s *Scheduler) poll(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		tasks, err := s.Tasks()
+		s.mu.Unlock()
+		if err != nil {
+			log.Printf("scheduler: %v", err)
+			continue
+		}
+		var active []*Task
+		for _, t := range tasks {
+			if last := t.LastRun(); last != nil && last.active() {
+				active = append(active, &t)
+			}
+		}
+		if len(active) == 0 {
+			continue
+		}
+		jobs := s.jobs(active...)
+
+		s.mu.Lock()
+		for _, old := range active {
+			t, err := s.Get(old.Name)
+			if err != nil {
+				continue // deleted since
+			}
+			s.refresh(t, jobs)
+			if err := s.put(t); err != nil {
+				log.Printf("scheduler: task %s: %v", t.Name, err)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// jobs fetches the rclone jobs of the tasks' running runs, nil for those
+// rclone no longer reports. It calls rclone, so s.mu must not be held.
+func (s *Scheduler) jobs(tasks ...*Task) map[int64]*rclone.Job {
+	jobs := make(map[int64]*rclone.Job)
+	for _, t := range tasks {
+		for _, run := range t.Runs {
+			if run.Status != "running" {
+				continue
+			}
+			if _, ok := jobs[run.JobID]; ok {
+				continue
+			}
+			job, err := s.rc.GetJob(run.JobID)
+			if err != nil {
+				job = nil
+			}
+			jobs[run.JobID] = job
+		}
+	}
+	return jobs
+}
+
+// refresh updates queued runs from the queue and running runs from jobs,
+// as fetched by s.jobs. Runs whose job was not fetched are left for the
+// next poll. Callers must hold s.mu.
+func (s *Scheduler) refresh(t *Task, jobs map[int64]*rclone.Job) {
+	for i := range t.Runs {
+		run := &t.Runs[i]
+		if run.Status == "queued" {
+			s.refreshQueued(run, t.Name)
+		}
+		if run.Status != "running" {
+			continue
+		}
+		job, checked := jobs[run.JobID]
+		if !checked {
+			continue
+		}
+		if job == nil || (run.ExecuteID != "" && job.ExecuteID != run.ExecuteID) {
+			// Expired, or rclone restarted and the ID now means another job.
+			run.Status = "error"
+			run.Error = "job no longer reported by rclone"
+			run.Finished = time.Now()
+			continue
+		}
+		if !job.Finished {
+			continue
+		}
+		run.Finished = time.Now()
+		if end, err := time.Parse(time.RFC3339Nano, job.EndTime); err == nil {
+			run.Finished = end
+		}
+		if job.Success {
+			run.Status = "finished"
+		} else {
+			run.Status = "error"
+			run.Error = job.Error
+		}
+	}
+}
+
+// refreshQueued moves a queued run on once the queue has launched or
+// dropped its item.
+func (s *Scheduler) refreshQueued(run *Run, name string) {
+	var item queue.Item
+	ok := s.Queue != nil
+	if ok {
+		item, ok = s.Queue.Get(run.QueueID)
+	}
+	if !ok || item.Source != "task:"+name {
+		// Queue IDs do not survive a restart of plat-rclone.
+		run.Status = "error"
+		run.Error = "dropped from the queue"
+		run.Finished = time.Now()
+		return
+	}
+	switch item.Status {
+	case "queued":
+	case "cancelled":
+		run.Status = "error"
+		run.Error = "cancelled while queued"
+		run.Finished = item.Finished
+	default:
+		run.JobID = item.JobID
+		run.ExecuteID = item.ExecuteID
+		run.Status = "running"
+		if item.JobID == 0 {
+			// The launch itself failed.
+			run.Status = "error"
+			run.Error = item.Error
+			run.Finished = item.Finished
+		}
+	}
+}
+
+// schedule (re)registers a task with cron. Callers must hold s.mu.
+func (s *Scheduler) schedule(t Task) error {
+	s.unschedule(t.Name)
+	if !t.Enabled {
+		return nil
+	}
+	name := t.Name
+	id, err := s.cron.AddFunc(t.Schedule, func() {
+		if _, err := s.run(name, false); err != nil {
+			log.Printf("scheduler: task %s: %v", name, err)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("invalid schedule %q: %w", t.Schedule, err)
+	}
+	s.entries[name] = id
+	return nil
+}
+
+// unschedule removes a task from cron. Callers must hold s.mu.
+func (s *Scheduler) unschedule(name string) {
+	if id, ok := s.entries[name]; ok {
+		s.cron.Remove(id)
+		delete(s.entries, name)
+	}
+}
+
+func (s *Scheduler) put(t *Task) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("marshal task: %w", err)
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(tasksBucket).Put([]byte(t.Name), data)
+	})
+}
@@ -0,0 +1,189 @@
+// Package stats samples rclone's core/stats into an in-memory ring buffer
+// so throughput can be charted over time.
+package stats
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/joeblew999/plat-rclone/pkg/rclone"
+)
+
+// Sample is one reading of core/stats. Bytes, Transfers and Errors are
+// rclone's running totals; Speed is the throughput since the previous
+// sample in bytes/s.
+type Sample struct {
+	Time         time.Time
+	Speed        float64
+	Bytes        int64
+	Transfers    int64
+	Errors       int64
+	Transferring int // files in flight
+}
+
+// Ring is a fixed-size circular buffer of samples.
+type Ring struct {
+	buf  []Sample
+	next int
+	full bool
+}
+
+// NewRing creates a ring holding up to size samples.
+func NewRing(size int) *Ring {
+	return &Ring{buf: make([]Sample, size)}
+}
+
+// Add appends s, overwriting the oldest sample when full.
+func (r *Ring) Add(s Sample) {
+	r.buf[r.next] = s
+	r.next = (r.next + 1) % len(r.buf)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Since returns the samples taken at or after t, oldest first.
+func (r *Ring) Since(t time.Time) []Sample {
+	var out []Sample
+	r.each(func(s Sample) {
+		if !s.Time.Before(t) {
+			out = append(out, s)
+		}
+	})
+	return out
+}
+
+func (r *Ring) each(fn func(Sample)) {
+	if r.full {
+		for _, s := range r.buf[r.next:] {
+			fn(s)
+		}
+	}
+	for _, s := range r.buf[:r.next] {
+		fn(s)
+	}
+}
+
+// Sampler polls core/stats at a fixed interval.
+type Sampler struct {
+	rc       *rclone.Client
+	interval time.Duration
+
+	mu   sync.Mutex
+	ring *Ring
+	last *Sample
+}
+
+// NewSampler creates a sampler that keeps retention worth of samples
+// taken every interval.
+func NewSampler(rc *rclone.Client, interval, retention time.Duration) *Sampler {
+	return &Sampler{
+		rc:       rc,
+		interval: interval,
+		ring:     NewRing(int(retention / interval)),
+	}
+}
+
+// Interval returns the time between samples.
+func (s *Sampler) Interval() time.Duration {
+	return s.interval
+}
+
+// Run samples until ctx is cancelled.
+func (s *Sampler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if err := s.sample(); err != nil {
+			log.Printf("stats: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Sampler) sample() error {
+	st, err := s.rc.Stats()
+	if err != nil {
+		return err
+	}
+	sample := Sample{Time: time.Now()}
+	if v, ok := st["bytes"].(float64); ok {
+		sample.Bytes = int64(v)
+	}
+	if v, ok := st["transfers"].(float64); ok {
+		sample.Transfers = int64(v)
+	}
+	if v, ok := st["errors"].(float64); ok {
+		sample.Errors = int64(v)
+	}
+	if v, ok := st["transferring"].([]any); ok {
+		sample.Transferring = len(v)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// core/stats only reports an average speed, which hides stalls, so the
+	// rate is derived from the byte total. A falling total means the stats
+	// were reset; fall back to rclone's figure for that sample.
+	if prev := s.last; prev != nil && sample.Bytes >= prev.Bytes {
+		sample.Speed = float64(sample.Bytes-prev.Bytes) / sample.Time.Sub(prev.Time).Seconds()
+	} else if v, ok := st["speed"].(float64); ok {
+		sample.Speed = v
+	}
+	s.ring.Add(sample)
+	s.last = &sample
+	return nil
+}
+
+// Window returns the samples of the last d, reduced to at most points
+// buckets. Within a bucket speed is averaged and the totals take their
+// last value, so short spikes are smoothed but nothing is lost from the
+// running counts.
+func (s *Sampler) Window(d time.Duration, points int) []Sample {
+	s.mu.Lock()
+	samples := s.ring.Since(time.Now().Add(-d))
+	s.mu.Unlock()
+
+	if points <= 0 || len(samples) <= points {
+		return samples
+	}
+	out := make([]Sample, 0, points)
+	for i := 0; i < points; i++ {
+		bucket := samples[i*len(samples)/points : (i+1)*len(samples)/points]
+		last := bucket[len(bucket)-1]
+		var speed float64
+		for _, b := range bucket {
+			speed += b.Speed
+		}
+		last.Speed = speed / float64(len(bucket))
+		out = append(out, last)
+	}
+	return out
+}
+
+// Stalled returns how long transfers have been in flight without any
+// throughput, or zero if data is moving or nothing is transferring.
+func (s *Sampler) Stalled() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var since, latest time.Time
+	s.ring.each(func(sample Sample) {
+		latest = sample.Time
+		if sample.Transferring == 0 || sample.Speed > 0 {
+			since = time.Time{}
+		} else if since.IsZero() {
+			since = sample.Time
+		}
+	})
+	if since.IsZero() {
+		return 0
+	}
+	return latest.Sub(since)
+}
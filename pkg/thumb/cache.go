@@ -0,0 +1,136 @@
+package thumb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Cache keeps made thumbnails on disk. Entries are keyed by the source's
+// path, ModTime and size, so an edited image gets a new thumbnail and the
+// old one ages out. When the cache grows past MaxBytes the least recently
+// used entries are removed.
+type Cache struct {
+	Dir      string
+	MaxBytes int64 // zero means no limit
+}
+
+// OpenCache uses dir for thumbnails, creating it if needed.
+func OpenCache(dir string, maxBytes int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Cache{Dir: dir, MaxBytes: maxBytes}, nil
+}
+
+// Key identifies the thumbnail of one version of remote:path at size.
+func Key(remote, path, modTime string, fileSize int64, size int) string {
+	sum := sha256.Sum256(fmt.Appendf(nil, "%s:%s\x00%s\x00%d\x00%d", remote, path, modTime, fileSize, size))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *Cache) file(key string) string {
+	return filepath.Join(c.Dir, key[:2], key+".jpg")
+}
+
+// Get returns the cached thumbnail for key, if there is one.
+func (c *Cache) Get(key string) ([]byte, bool) {
+	name := c.file(key)
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, false
+	}
+	// The access time is not reliable, so the ModTime records use
+	now := time.Now()
+	os.Chtimes(name, now, now)
+	return data, true
+}
+
+// Put stores a thumbnail under key.
+func (c *Cache) Put(key string, data []byte) error {
+	name := c.file(key)
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// Prune removes the least recently used thumbnails until the cache is
+// within MaxBytes, and returns how many it removed.
+func (c *Cache) Prune() (int, error) {
+	if c.MaxBytes <= 0 {
+		return 0, nil
+	}
+	type entry struct {
+		name string
+		size int64
+		used time.Time
+	}
+	var entries []entry
+	var total int64
+	err := filepath.WalkDir(c.Dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		entries = append(entries, entry{name, info.Size(), info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].used.Before(entries[j].used) })
+	n := 0
+	for _, e := range entries {
+		if total <= c.MaxBytes {
+			break
+		}
+		if err := os.Remove(e.name); err == nil {
+			total -= e.size
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Run prunes the cache every interval until ctx is done.
+func (c *Cache) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if n, err := c.Prune(); err != nil {
+			log.Printf("thumb: prune: %v", err)
+		} else if n > 0 {
+			log.Printf("thumb: pruned %d cached thumbnails", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Package thumb makes small JPEG thumbnails of JPEG, PNG, GIF and WebP
+// images in pure Go, so the preview panel and the gallery do not ship a
+// multi-MB photo to show it in a few hundred pixels.
+package thumb
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"path"
+	"strings"
+
+	"golang.org/x/image/draw"
+
+	// Decoders for image.Decode
+	_ "image/gif"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// MaxSource is the largest image file that is thumbnailed. Bigger
+	// files are left to the browser.
+	MaxSource = 32 << 20
+
+	// maxPixels bounds the decoded image, whatever its file size.
+	maxPixels = 50_000_000
+
+	// DefaultSize is the thumbnail's longest side when none is asked for.
+	DefaultSize = 480
+	maxSize     = 1600
+)
+
+var supported = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true}
+
+// Supported reports whether a thumbnail can be made for the named file.
+func Supported(name string) bool {
+	return supported[strings.ToLower(path.Ext(name))]
+}
+
+// ClampSize limits a requested thumbnail size to something sensible.
+func ClampSize(size int) int {
+	if size <= 0 {
+		return DefaultSize
+	}
+	return min(size, maxSize)
+}
+
+// Make decodes the image in r and writes a JPEG no larger than size on its
+// longest side to w. Smaller images are re-encoded at their own size.
+// Transparent areas become white.
+func Make(w io.Writer, r io.Reader, size int) error {
+	data, err := io.ReadAll(io.LimitReader(r, MaxSource+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > MaxSource {
+		return fmt.Errorf("image is larger than %d MiB", MaxSource>>20)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return fmt.Errorf("image is too large to thumbnail (%dx%d)", cfg.Width, cfg.Height)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	b := src.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if scale := float64(ClampSize(size)) / float64(max(width, height)); scale < 1 {
+		width = max(1, int(float64(width)*scale))
+		height = max(1, int(float64(height)*scale))
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.BiLinear.Scale(dst, dst.Bounds(), src, b, draw.Over, nil)
+	return jpeg.Encode(w, dst, &jpeg.Options{Quality: 80})
+}
@@ -0,0 +1,346 @@
+// Package trash gives the file browser a recycle bin. Deleted items are
+// moved into a trash folder on their own remote, which is a cheap
+// server-side move on most backends and can be undone. A bbolt index
+// remembers where each item came from and when it was deleted.
+package trash
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/joeblew999/plat-rclone/internal/storage"
+	"github.com/joeblew999/plat-rclone/pkg/rclone"
+)
+
+// DefaultDir is the trash folder used when a remote has no override.
+const DefaultDir = ".plat-rclone-trash"
+
+var itemsBucket = []byte("items")
+
+// Item is one deleted file or directory.
+type Item struct {
+	ID      string    `json:"id"`
+	Remote  string    `json:"remote"`
+	Path    string    `json:"path"`  // where it was deleted from
+	Entry   string    `json:"entry"` // its folder in the trash, holding Path
+	IsDir   bool      `json:"isDir"`
+	Size    int64     `json:"size"`
+	Deleted time.Time `json:"deleted"`
+}
+
+// TrashPath returns where the item now lives on its remote.
+func (it *Item) TrashPath() string {
+	return path.Join(it.Entry, it.Path)
+}
+
+// Trash moves deleted items aside and restores or purges them later.
+type Trash struct {
+	rc *rclone.Client
+	db *bolt.DB
+
+	// Dir is the trash folder, relative to each remote's root.
+	Dir string
+	// Dirs overrides Dir per remote. An empty value disables the trash
+	// for that remote, so deletes there are permanent.
+	Dirs map[string]string
+	// Retention is how long items are kept before Expire purges them.
+	// Zero keeps them until purged by hand.
+	Retention time.Duration
+}
+
+// Open opens (or creates) the trash index at path.
+func Open(path string, rc *rclone.Client) (*Trash, error) {
+	db, err := storage.OpenBolt(path, itemsBucket)
+	if err != nil {
+		return nil, fmt.Errorf("open trash: %w", err)
+	}
+	return &Trash{rc: rc, db: db, Dir: DefaultDir}, nil
+}
+
+// Close closes the index.
+func (t *Trash) Close() error {
+	return t.db.Close()
+}
+
+// DirFor returns the trash folder of remote, or "" if it has none.
+func (t *Trash) DirFor(remote string) string {
+	if dir, ok := t.Dirs[remote]; ok {
+		return strings.Trim(dir, "/")
+	}
+	return strings.Trim(t.Dir, "/")
+}
+
+// Holds reports whether p is the trash folder of remote or inside it.
+func (t *Trash) Holds(remote, p string) bool {
+	dir := t.DirFor(remote)
+	p = strings.Trim(p, "/")
+	return dir != "" && (p == dir || strings.HasPrefix(p, dir+"/"))
+}
+
+// ExcludeRule returns a filter rule matching the trash folder of remote in
+// a recursive listing of dir, so it can be left out. It is "" if the trash
+// is not below dir, as when dir is inside it.
+func (t *Trash) ExcludeRule(remote, dir string) string {
+	trashDir := t.DirFor(remote)
+	if trashDir == "" {
+		return ""
+	}
+	if dir = strings.Trim(dir, "/"); dir != "" {
+		var ok bool
+		if trashDir, ok = strings.CutPrefix(trashDir, dir+"/"); !ok {
+			return ""
+		}
+	}
+	return rclone.DirRule(trashDir)
+}
+
+// ParseDirs parses a comma-separated list of trash folders. An entry of
+// the form remote=dir overrides the folder for one remote; a bare entry
+// sets the default.
+func ParseDirs(s string) (dir string, dirs map[string]string) {
+	dir = DefaultDir
+	dirs = map[string]string{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if remote, d, ok := strings.Cut(part, "="); ok {
+			dirs[strings.TrimSpace(remote)] = strings.TrimSpace(d)
+		} else if part != "" {
+			dir = part
+		}
+	}
+	return dir, dirs
+}
+
+// Delete moves the item at p into the remote's trash folder. If the remote
+// has no trash folder the item is deleted for good and nil is returned.
+func (t *Trash) Delete(remote, p string) (*Item, error) {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return nil, fmt.Errorf("refusing to delete the root of %s:", remote)
+	}
+	st, err := t.rc.Stat(remote, p)
+	if err != nil {
+		return nil, err
+	}
+	if st == nil {
+		return nil, fmt.Errorf("%s:%s not found", remote, p)
+	}
+
+	dir := t.DirFor(remote)
+	if dir == "" {
+		if st.IsDir {
+			return nil, t.rc.Purge(remote, p)
+		}
+		return nil, t.rc.Delete(remote, p)
+	}
+	if t.Holds(remote, p) {
+		return nil, fmt.Errorf("%s is inside the trash; purge it from the Trash page", p)
+	}
+	if strings.HasPrefix(dir, p+"/") {
+		// Moving it into the trash would move it into itself
+		return nil, fmt.Errorf("%s holds the trash folder; delete what is in it instead", p)
+	}
+
+	it := &Item{
+		ID:      newID(),
+		Remote:  remote,
+		Path:    p,
+		IsDir:   st.IsDir,
+		Size:    st.Size,
+		Deleted: time.Now(),
+	}
+	it.Entry = path.Join(dir, it.ID)
+	if st.IsDir {
+		if _, size, err := t.rc.Size(remote, p); err == nil {
+			it.Size = size
+		}
+		err = t.rc.MoveDir(remote, p, remote, it.TrashPath())
+		if err == nil {
+			// Some backends keep the emptied top directory after sync/move
+			t.rc.Rmdir(remote, p)
+		}
+	} else {
+		err = t.rc.MoveFile(remote, p, remote, it.TrashPath())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return it, t.put(it)
+}
+
+// Restore moves an item back to where it was deleted from. It fails
+// rather than overwrite something created there since.
+func (t *Trash) Restore(id string) (*Item, error) {
+	it, err := t.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := t.rc.Stat(it.Remote, it.Path)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("%s:%s already exists; move it away first", it.Remote, it.Path)
+	}
+	if it.IsDir {
+		err = t.rc.MoveDir(it.Remote, it.TrashPath(), it.Remote, it.Path)
+	} else {
+		err = t.rc.MoveFile(it.Remote, it.TrashPath(), it.Remote, it.Path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Only empty folders are left in the entry; rmdirs will not touch data.
+	if err := t.rc.Rmdirs(it.Remote, it.Entry, false); err != nil {
+		log.Printf("trash: tidy %s:%s: %v", it.Remote, it.Entry, err)
+	}
+	return it, t.remove(id)
+}
+
+// Purge deletes an item permanently.
+func (t *Trash) Purge(id string) (*Item, error) {
+	it, err := t.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.rc.Purge(it.Remote, it.Entry); err != nil {
+		// Already gone from the remote: just forget it.
+		if st, serr := t.rc.Stat(it.Remote, it.Entry); serr != nil || st != nil {
+			return nil, err
+		}
+	}
+	return it, t.remove(id)
+}
+
+// Get returns the item with the given ID.
+func (t *Trash) Get(id string) (*Item, error) {
+	var it *Item
+	err := t.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(itemsBucket).Get([]byte(id))
+		if data == nil {
+			return fmt.Errorf("trash item %q not found", id)
+		}
+		it = new(Item)
+		return json.Unmarshal(data, it)
+	})
+	return it, err
+}
+
+// List returns the items of remote, or of every remote if it is empty,
+// most recently deleted first.
+func (t *Trash) List(remote string) ([]Item, error) {
+	var items []Item
+	err := t.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(itemsBucket).ForEach(func(k, v []byte) error {
+			var it Item
+			if err := json.Unmarshal(v, &it); err != nil {
+				return fmt.Errorf("unmarshal trash item %s: %w", k, err)
+			}
+			if remote == "" || it.Remote == remote {
+				items = append(items, it)
+			}
+			return nil
+		})
+	})
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Deleted.After(items[j].Deleted)
+	})
+	return items, err
+}
+
+// Expires returns when an item deleted at deleted will be purged, or the
+// zero time if the retention policy keeps items forever.
+func (t *Trash) Expires(deleted time.Time) time.Time {
+	if t.Retention <= 0 {
+		return time.Time{}
+	}
+	return deleted.Add(t.Retention)
+}
+
+// Empty purges every item of remote, or of every remote if it is empty.
+// It carries on past failures and returns how many items were purged.
+func (t *Trash) Empty(remote string) (int, error) {
+	return t.purgeWhere(remote, func(Item) bool { return true })
+}
+
+// Expire purges items older than the retention period.
+func (t *Trash) Expire() (int, error) {
+	if t.Retention <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().Add(-t.Retention)
+	return t.purgeWhere("", func(it Item) bool { return it.Deleted.Before(cutoff) })
+}
+
+// Run applies the retention policy every interval until ctx is cancelled.
+func (t *Trash) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if n, err := t.Expire(); err != nil {
+			log.Printf("trash: expire: %v", err)
+		} else if n > 0 {
+			log.Printf("trash: purged %d expired items", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (t *Trash) purgeWhere(remote string, match func(Item) bool) (int, error) {
+	items, err := t.List(remote)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	var firstErr error
+	for _, it := range items {
+		if !match(it) {
+			continue
+		}
+		if _, err := t.Purge(it.ID); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("purge %s:%s: %w", it.Remote, it.Path, err)
+			}
+			continue
+		}
+		n++
+	}
+	return n, firstErr
+}
+
+func (t *Trash) put(it *Item) error {
+	data, err := json.Marshal(it)
+	if err != nil {
+		return fmt.Errorf("marshal trash item: %w", err)
+	}
+	return t.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(itemsBucket).Put([]byte(it.ID), data)
+	})
+}
+
+func (t *Trash) remove(id string) error {
+	return t.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(itemsBucket).Delete([]byte(id))
+	})
+}
+
+// newID returns a sortable, unique name for a trash entry.
+func newID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,75 @@
+package usage
+
+// Rect is a tile of a treemap.
+type Rect struct {
+	X, Y, W, H float64
+}
+
+// Treemap lays sizes, largest first, out as tiles filling a w by h
+// rectangle, each with an area in proportion to its size. Tiles are kept
+// as square as possible (the "squarified" layout of Bruls, Huizing and van
+// Wijk), so they are easy to compare and to click.
+func Treemap(sizes []int64, w, h float64) []Rect {
+	rects := make([]Rect, len(sizes))
+	var total float64
+	for _, s := range sizes {
+		total += float64(max(s, 0))
+	}
+	if total == 0 {
+		return rects
+	}
+	areas := make([]float64, len(sizes))
+	for i, s := range sizes {
+		areas[i] = float64(max(s, 0)) * w * h / total
+	}
+
+	x, y := 0.0, 0.0
+	for i := 0; i < len(areas); {
+		// Add tiles to the row along the short side while that makes the
+		// row's worst aspect ratio better
+		short := min(w, h)
+		j := i + 1
+		for j < len(areas) && worst(areas[i:j+1], short) <= worst(areas[i:j], short) {
+			j++
+		}
+		var row float64
+		for _, a := range areas[i:j] {
+			row += a
+		}
+		if row == 0 {
+			break
+		}
+		if w >= h {
+			cw := row / h
+			for k, yy := i, y; k < j; k++ {
+				rects[k] = Rect{x, yy, cw, areas[k] / cw}
+				yy += areas[k] / cw
+			}
+			x, w = x+cw, w-cw
+		} else {
+			rh := row / w
+			for k, xx := i, x; k < j; k++ {
+				rects[k] = Rect{xx, y, areas[k] / rh, rh}
+				xx += areas[k] / rh
+			}
+			y, h = y+rh, h-rh
+		}
+		i = j
+	}
+	return rects
+}
+
+// worst is the largest aspect ratio of row laid along a side of length side.
+func worst(row []float64, side float64) float64 {
+	var sum, lo, hi float64
+	lo = row[0]
+	for _, a := range row {
+		sum += a
+		lo, hi = min(lo, a), max(hi, a)
+	}
+	if lo == 0 || sum == 0 {
+		return 0
+	}
+	s2, sum2 := side*side, sum*sum
+	return max(s2*hi/sum2, sum2/(s2*lo))
+}
@@ -0,0 +1,225 @@
+// Package usage works out what takes up the space below a folder, in the
+// manner of ncdu: a recursive listing is summed into a tree of folders,
+// which can then be browsed without listing again.
+package usage
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KeepFiles is how many of its largest files each folder keeps by name.
+// The rest are summed into a single entry as the scan goes, so a folder
+// of millions of files holds at most twice this many at any time.
+const KeepFiles = 100
+
+// Node is a folder or file in a scan, with the total size and number of
+// files below it.
+type Node struct {
+	Name     string
+	Size     int64
+	Files    int64
+	IsDir    bool
+	Rest     bool    // the summed smaller files of a folder
+	Children []*Node // largest first
+
+	dirs  map[string]*Node // while scanning
+	rest  *Node            // while scanning, the smaller files summed so far
+	loose int              // while scanning, the files in Children
+}
+
+// Scan is the tree below Root on Remote. Paths are relative to the
+// remote's root, without leading or trailing slashes.
+type Scan struct {
+	Remote string
+	Root   string
+	Tree   *Node
+	Time   time.Time
+
+	// Counted is the number of files and bytes below Root as rclone's
+	// operations/size reported them, if it did in time.
+	Counted      bool
+	CountedFiles int64
+	CountedBytes int64
+}
+
+// NewScan starts an empty scan of remote:root.
+func NewScan(remote, root string) *Scan {
+	return &Scan{
+		Remote: remote,
+		Root:   root,
+		Tree:   &Node{Name: root, IsDir: true},
+		Time:   time.Now(),
+	}
+}
+
+// Add counts a file at path, relative to the scan's root.
+func (s *Scan) Add(path string, size int64) {
+	if size < 0 {
+		size = 0
+	}
+	n := s.Tree
+	names := strings.Split(path, "/")
+	for _, name := range names[:len(names)-1] {
+		n.Size += size
+		n.Files++
+		if n.dirs == nil {
+			n.dirs = map[string]*Node{}
+		}
+		dir, ok := n.dirs[name]
+		if !ok {
+			dir = &Node{Name: name, IsDir: true}
+			n.dirs[name] = dir
+			n.Children = append(n.Children, dir)
+		}
+		n = dir
+	}
+	n.Size += size
+	n.Files++
+	n.Children = append(n.Children, &Node{Name: names[len(names)-1], Size: size, Files: 1})
+	if n.loose++; n.loose > 2*KeepFiles {
+		n.compact()
+	}
+}
+
+// compact sums the files of n beyond its KeepFiles largest into n.rest.
+// A file summed away could not make the largest later, as KeepFiles
+// larger ones stay.
+func (n *Node) compact() {
+	var dirs, files []*Node
+	for _, c := range n.Children {
+		if c.IsDir {
+			dirs = append(dirs, c)
+		} else {
+			files = append(files, c)
+		}
+	}
+	slices.SortStableFunc(files, bySize)
+	if n.rest == nil {
+		n.rest = &Node{Rest: true}
+	}
+	for _, f := range files[KeepFiles:] {
+		n.rest.Size += f.Size
+		n.rest.Files++
+	}
+	n.Children = append(dirs, files[:KeepFiles]...)
+	n.loose = KeepFiles
+}
+
+// bySize orders nodes largest first, then by name.
+func bySize(a, b *Node) int {
+	if a.Size != b.Size {
+		if a.Size > b.Size {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a.Name, b.Name)
+}
+
+// Finish sorts every folder largest first and sums each folder's files
+// beyond the KeepFiles largest. Call it once everything has been added.
+func (s *Scan) Finish() {
+	finish(s.Tree)
+}
+
+func finish(n *Node) {
+	n.dirs = nil
+	slices.SortStableFunc(n.Children, bySize)
+	kept := n.Children[:0]
+	rest := n.rest
+	if rest == nil {
+		rest = &Node{Rest: true}
+	}
+	n.rest, n.loose = nil, 0
+	files := 0
+	for _, c := range n.Children {
+		if c.IsDir {
+			finish(c)
+		} else if files++; files > KeepFiles {
+			rest.Size += c.Size
+			rest.Files++
+			continue
+		}
+		kept = append(kept, c)
+	}
+	if rest.Files > 0 {
+		rest.Name = fmt.Sprintf("%d smaller files", rest.Files)
+		kept = append(kept, rest)
+	}
+	n.Children = kept
+}
+
+// Find returns the folder at path, relative to the remote's root, or nil
+// if it is not in the scan.
+func (s *Scan) Find(path string) *Node {
+	rel, ok := within(s.Root, path)
+	if !ok {
+		return nil
+	}
+	n := s.Tree
+	if rel == "" {
+		return n
+	}
+	for _, name := range strings.Split(rel, "/") {
+		var next *Node
+		for _, c := range n.Children {
+			if c.IsDir && c.Name == name {
+				next = c
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		n = next
+	}
+	return n
+}
+
+// within returns path relative to root, if it is root or below it.
+func within(root, path string) (string, bool) {
+	if root == "" || path == root {
+		return strings.TrimPrefix(path, root), true
+	}
+	rel, ok := strings.CutPrefix(path, root+"/")
+	return rel, ok
+}
+
+// Cache keeps the most recent scans, so drilling into a folder, or
+// coming back to it, does not list the remote again.
+type Cache struct {
+	Max int // scans kept
+
+	mu    sync.Mutex
+	scans []*Scan // most recent first
+}
+
+// Get returns the newest scan covering remote:path, or nil.
+func (c *Cache) Get(remote, path string) *Scan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, s := range c.scans {
+		if s.Remote == remote && s.Find(path) != nil {
+			return s
+		}
+	}
+	return nil
+}
+
+// Put adds a finished scan, replacing any it covers.
+func (c *Cache) Put(s *Scan) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.scans = slices.DeleteFunc(c.scans, func(old *Scan) bool {
+		_, covered := within(s.Root, old.Root)
+		return old.Remote == s.Remote && covered
+	})
+	c.scans = append([]*Scan{s}, c.scans...)
+	if len(c.scans) > c.Max {
+		c.scans = c.scans[:c.Max]
+	}
+}
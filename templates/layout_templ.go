@@ -42,7 +42,7 @@ func Layout(title string) templ.Component {
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, " - plat-rclone</title><script type=\"module\" src=\"/static/js/datastar.js\"></script><link href=\"/static/css/style.css\" rel=\"stylesheet\"></head><body><nav class=\"navbar\"><a href=\"/\" class=\"logo\">plat-rclone</a><div class=\"nav-links\"><a href=\"/\">Remotes</a> <a href=\"/jobs\">Jobs</a> <a href=\"/stats\">Stats</a></div></nav><main class=\"container\">")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, " - plat-rclone</title><script type=\"module\" src=\"/static/js/datastar.js\"></script><link href=\"/static/css/style.css\" rel=\"stylesheet\"></head><body><nav class=\"navbar\"><a href=\"/\" class=\"logo\">plat-rclone</a><div class=\"nav-links\"><a href=\"/\">Remotes</a> <a href=\"/search\">Search</a> <a href=\"/duplicates\">Duplicates</a> <a href=\"/jobs\">Jobs</a> <a href=\"/tasks\">Tasks</a> <a href=\"/profiles\">Profiles</a> <a href=\"/notifications\">Notifications</a> <a href=\"/stats\">Stats</a> <a href=\"/trash\">Trash</a> <a href=\"/audit\">Audit</a></div></nav><main class=\"container\">")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -50,7 +50,7 @@ func Layout(title string) templ.Component {
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, "</main></body></html>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, "</main><div id=\"toast\"></div></body></html>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
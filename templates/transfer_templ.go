@@ -0,0 +1,88 @@
+// Code generated by templ - DO NOT EDIT.
+
+// templ: version: v0.3.977
+package templates
+
+//lint:file-ignore SA4006 This context is only used if a nested component is present.
+
+import "github.com/a-h/templ"
+import templruntime "github.com/a-h/templ/runtime"
+
+// transferSignals returns the initial Datastar signals of a copy/sync dialog.
+func transferSignals(src string) (string, error) {
+	return templ.JSONString(map[string]any{
+		"transfer": map[string]any{
+			"op":      "copy",
+			"src":     src,
+			"dst":     "",
+			"group":   "",
+			"include": "",
+			"exclude": "",
+			"dryRun":  false,
+		},
+		"profileName": "",
+		"priority":    "normal",
+	})
+}
+
+// TransferFields renders the inputs of a copy/sync dialog, bound to $transfer.
+func TransferFields() templ.Component {
+	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
+		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
+		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
+			return templ_7745c5c3_CtxErr
+		}
+		templ_7745c5c3_Buffer, templ_7745c5c3_IsBuffer := templruntime.GetBuffer(templ_7745c5c3_W)
+		if !templ_7745c5c3_IsBuffer {
+			defer func() {
+				templ_7745c5c3_BufErr := templruntime.ReleaseBuffer(templ_7745c5c3_Buffer)
+				if templ_7745c5c3_Err == nil {
+					templ_7745c5c3_Err = templ_7745c5c3_BufErr
+				}
+			}()
+		}
+		ctx = templ.InitializeContext(ctx)
+		templ_7745c5c3_Var1 := templ.GetChildren(ctx)
+		if templ_7745c5c3_Var1 == nil {
+			templ_7745c5c3_Var1 = templ.NopComponent
+		}
+		ctx = templ.ClearChildren(ctx)
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<div class=\"form-grid\"><label>Operation <select class=\"input\" data-bind=\"transfer.op\"><option value=\"copy\">Copy</option> <option value=\"sync\">Sync</option> <option value=\"move\">Move</option></select></label> <label>Group <input class=\"input\" placeholder=\"e.g. backup:photos\" data-bind=\"transfer.group\"></label> <label>Source <input class=\"input\" placeholder=\"remote:path\" data-bind=\"transfer.src\"></label> <label>Destination <input class=\"input\" placeholder=\"remote:path\" data-bind=\"transfer.dst\"></label> <label>Include rules (one per line) <textarea class=\"input\" rows=\"2\" placeholder=\"*.jpg\" data-bind=\"transfer.include\"></textarea></label> <label>Exclude rules (one per line) <textarea class=\"input\" rows=\"2\" placeholder=\"*.tmp\" data-bind=\"transfer.exclude\"></textarea></label></div><label class=\"checkbox\"><input type=\"checkbox\" data-bind=\"transfer.dryRun\"> Dry run</label>")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		return nil
+	})
+}
+
+// SaveProfileControl saves the current $transfer as a named profile.
+func SaveProfileControl() templ.Component {
+	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
+		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
+		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
+			return templ_7745c5c3_CtxErr
+		}
+		templ_7745c5c3_Buffer, templ_7745c5c3_IsBuffer := templruntime.GetBuffer(templ_7745c5c3_W)
+		if !templ_7745c5c3_IsBuffer {
+			defer func() {
+				templ_7745c5c3_BufErr := templruntime.ReleaseBuffer(templ_7745c5c3_Buffer)
+				if templ_7745c5c3_Err == nil {
+					templ_7745c5c3_Err = templ_7745c5c3_BufErr
+				}
+			}()
+		}
+		ctx = templ.InitializeContext(ctx)
+		templ_7745c5c3_Var2 := templ.GetChildren(ctx)
+		if templ_7745c5c3_Var2 == nil {
+			templ_7745c5c3_Var2 = templ.NopComponent
+		}
+		ctx = templ.ClearChildren(ctx)
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, "<div class=\"toolbar save-profile\"><input class=\"input\" placeholder=\"Profile name, e.g. photos-backup\" data-bind=\"profileName\"> <button class=\"btn btn-sm\" data-on:click=\"@post('/api/profiles')\">Save as profile</button></div><div id=\"profile-status\"></div>")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		return nil
+	})
+}
+
+var _ = templruntime.GeneratedTemplate